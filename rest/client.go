@@ -5,14 +5,21 @@ package rest
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -43,9 +50,31 @@ type Client struct {
 	// then no limits are imposed.
 	Limit uint
 
+	// Timeout is the default timeout applied to every request originating from
+	// this client. It can be overridden for a single request via the
+	// Request.SetTimeout method. Unlike http.Client.Timeout, it's applied via
+	// the context of each request and therefore doesn't require a dedicated
+	// http.Client. If not set then no timeouts are imposed.
+	Timeout time.Duration
+
+	// HealthPath is the path probed by the Ping method. Unlike the paths of
+	// regular requests, Root is not prepended to it. Defaults to "/".
+	HealthPath string
+
+	// SignFunc is the default value of Request.SignFunc for the requests
+	// originating from this client.
+	SignFunc func(*Request) (header, value string)
+
+	// Observer is called with the response of every request originating from
+	// this client once it was sent, including all of its retries, which can
+	// be used to record metrics.
+	Observer func(*Response)
+
 	initialize sync.Once
 
 	limit chan struct{}
+
+	pool *pool
 }
 
 // NewRequest creates a new Request object for the given HTTP method.
@@ -80,7 +109,42 @@ func (client *Client) NewRequest(method string) *Request {
 		Root:      client.Root,
 		Header:    headers,
 		GzipLevel: client.GzipLevel,
+		Timeout:   client.Timeout,
+		SignFunc:  client.SignFunc,
+	}
+}
+
+// EnableCookies installs a cookie jar on the http.Client of the client so that
+// the cookies set by the endpoint are sent back on subsequent requests. The
+// http.Client is copied beforehand to avoid installing the jar on a shared
+// client such as http.DefaultClient. Must be called before creating requests.
+func (client *Client) EnableCookies() {
+	jar, _ := cookiejar.New(nil)
+
+	httpClient := new(http.Client)
+	if client.Client != nil {
+		*httpClient = *client.Client
+	}
+	httpClient.Jar = jar
+
+	client.Client = httpClient
+}
+
+// Ping sends a HEAD request to the HealthPath of the host and returns nil if
+// the endpoint responded with a 2xx status code. It's useful to check the
+// connectivity to the host or to warm up connections before serving traffic.
+func (client *Client) Ping(ctx context.Context) error {
+	req := client.NewRequest("HEAD").SetContext(ctx)
+
+	req.Path = client.HealthPath
+	if len(req.Path) == 0 {
+		req.Path = "/"
+	}
+
+	if err := req.Send().GetBody(nil); err != nil {
+		return err
 	}
+	return nil
 }
 
 func (client *Client) begin() {
@@ -135,13 +199,86 @@ type Request struct {
 	// GzipLevel is used to compress requests using gzip.
 	GzipLevel int
 
-	// Body is the JSON serialized body of the HTTP request. Can be set via the
-	// SetBody method.
+	// Timeout is the maximum amount of time allowed for the request
+	// round-trip, including reading the body of the response. Can be changed
+	// via the SetTimeout method.
+	Timeout time.Duration
+
+	// Context controls the lifetime of the request. Cancelling the context
+	// aborts the round-trip. Defaults to context.Background and can be changed
+	// via the SetContext method.
+	Context context.Context
+
+	// Retries is the maximum number of times an idempotent request is retried
+	// after a connection error or a status code in RetryCodes. Can be set via
+	// the SetRetry method.
+	Retries int
+
+	// StreamResponse indicates that the body of the response should be left
+	// open and exposed via Response.BodyReader instead of being buffered in
+	// Response.Body. Can be set via the SetStreamResponse method.
+	StreamResponse bool
+
+	// RetryBackoff is the delay before the first retry which is doubled after
+	// each subsequent attempt. Can be set via the SetRetry method.
+	RetryBackoff time.Duration
+
+	// RetryCodes is the list of status codes which trigger a retry. Defaults
+	// to DefaultRetryCodes and can be changed via the SetRetryCodes method.
+	RetryCodes []int
+
+	// RespectRetryAfter indicates that the Retry-After header of 429 and 503
+	// responses should be used as the delay before the next retry instead of
+	// the backoff. Responses with a 429 status code also become retryable.
+	// Can be set via the SetRespectRetryAfter method.
+	RespectRetryAfter bool
+
+	// MaxRetryAfter bounds the delay requested by a Retry-After header.
+	// Defaults to DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+
+	// Body is the serialized body of the HTTP request. Can be set via the
+	// SetBody or SetBodyRaw methods.
 	Body []byte
 
+	// BodyReader streams the body of the HTTP request and takes precedence
+	// over Body. Can be set via the SetBodyReader method.
+	BodyReader io.Reader
+
+	// ContentLength is the length of the body read from BodyReader. A
+	// negative value indicates an unknown length which is sent using chunked
+	// transfer encoding.
+	ContentLength int64
+
+	// UploadProgress is called as the body of the request is sent with the
+	// number of bytes sent so far and the total length of the body, or -1 if
+	// unknown. Can be set via the SetUploadProgress method.
+	UploadProgress func(sent, total int64)
+
+	// ContentType is the content type of the body. Defaults to
+	// the content type of the codec and can be set via the SetBodyRaw method.
+	ContentType string
+
+	// Codec serializes the body of the request and deserializes the body of
+	// the response. Defaults to JSONCodec and can be set via the SetCodec
+	// method.
+	Codec Codec
+
+	// SignFunc is called before each attempt to send the request, once its
+	// body is final and HTTP is set, and returns a header to add to the
+	// request, typically a signature of the request and its Body. Can be set
+	// via the SetSignFunc method.
+	SignFunc func(*Request) (header, value string)
+
+	// CheckRedirect overrides the redirect policy of Client for this request
+	// only. Can be set via the SetFollowRedirects method.
+	CheckRedirect func(httpReq *http.Request, via []*http.Request) error
+
 	HTTP *http.Request
 
 	err *Error
+
+	bodyOffset int64
 }
 
 // NewRequest creates a new Request object to be sent to the given host using
@@ -173,6 +310,89 @@ func (req *Request) SetPath(path string, args ...interface{}) *Request {
 	return req
 }
 
+// SetSignFunc sets the function used to sign the request. The function can
+// inspect the method and URL of the request via its HTTP field and the exact
+// bytes of the body via its Body field. Bodies streamed via SetBodyReader
+// can't be inspected.
+func (req *Request) SetSignFunc(fn func(*Request) (header, value string)) *Request {
+	req.SignFunc = fn
+	return req
+}
+
+// SetFollowRedirects limits the number of redirects followed by the request to
+// max without changing the redirect policy of the shared http.Client. Once the
+// limit is reached, the last redirect response is returned as-is which GetBody
+// reports as an UnexpectedStatusCode error. A max of zero disables redirects.
+func (req *Request) SetFollowRedirects(max int) *Request {
+	req.CheckRedirect = func(httpReq *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	return req
+}
+
+// SetTimeout sets the maximum amount of time allowed for the request
+// round-trip. A zero duration disables the timeout.
+func (req *Request) SetTimeout(timeout time.Duration) *Request {
+	req.Timeout = timeout
+	return req
+}
+
+// SetContext sets the context used to control the lifetime of the request. If
+// the context is cancelled or its deadline expires then the request is aborted
+// and the Response will contain a ContextError.
+func (req *Request) SetContext(ctx context.Context) *Request {
+	req.Context = ctx
+	return req
+}
+
+// DefaultRetryCodes is the default list of status codes for which a request is
+// retried.
+var DefaultRetryCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultMaxRetryAfter is the default value of Request.MaxRetryAfter.
+const DefaultMaxRetryAfter = time.Minute
+
+// SetRespectRetryAfter enables or disables the use of the Retry-After header of
+// 429 and 503 responses, in either its delay-seconds or HTTP-date form, as the
+// delay before the next retry. The delay is bounded by MaxRetryAfter. Retries
+// must be enabled via SetRetry.
+func (req *Request) SetRespectRetryAfter(respect bool) *Request {
+	req.RespectRetryAfter = respect
+	return req
+}
+
+// SetRetry enables the retry of idempotent requests (GET, HEAD, PUT, DELETE,
+// OPTIONS and TRACE) up to max times after a connection error or a retryable
+// status code. The delay between attempts starts at backoff and doubles after
+// each attempt. Retries stop early if the context of the request is done.
+func (req *Request) SetRetry(max int, backoff time.Duration) *Request {
+	req.Retries = max
+	req.RetryBackoff = backoff
+	return req
+}
+
+// SetStreamResponse enables or disables the streaming of the response body.
+// When enabled, the body is exposed via Response.BodyReader which the caller
+// MUST close to avoid leaking connections. Response.GetBody can still be used
+// and reads the remainder of the stream before closing it.
+func (req *Request) SetStreamResponse(stream bool) *Request {
+	req.StreamResponse = stream
+	return req
+}
+
+// SetRetryCodes sets the list of status codes which trigger a retry.
+func (req *Request) SetRetryCodes(codes ...int) *Request {
+	req.RetryCodes = codes
+	return req
+}
+
 // SetGzipLevel sets the compression level, must be called before SetBody.
 func (req *Request) SetGzipLevel(level int) *Request {
 	req.GzipLevel = level
@@ -188,6 +408,60 @@ func (req *Request) AddParam(key, value string) *Request {
 	return req
 }
 
+// SetAcceptGzip indicates to the remote endpoint that the response can be
+// compressed using gzip. Compressed responses are transparently decompressed.
+func (req *Request) SetAcceptGzip() *Request {
+	return req.setHeader("Accept-Encoding", "gzip")
+}
+
+// SetBasicAuth sets the Authorization header of the request to use HTTP basic
+// authentication with the given credentials, replacing any previous value.
+func (req *Request) SetBasicAuth(user, password string) *Request {
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	return req.setHeader("Authorization", "Basic "+auth)
+}
+
+// SetBearerToken sets the Authorization header of the request to use the given
+// bearer token, replacing any previous value.
+func (req *Request) SetBearerToken(token string) *Request {
+	return req.setHeader("Authorization", "Bearer "+token)
+}
+
+// SetAPIKey sets the given header to the given API key, replacing any previous
+// value.
+func (req *Request) SetAPIKey(header, key string) *Request {
+	return req.setHeader(header, key)
+}
+
+// SetRequestID sets the DefaultRequestIDHeader of the request to the given ID.
+// Requests whose context holds a request ID, such as the context of a request
+// served by a Mux with a RequestIDHeader, carry that ID by default.
+func (req *Request) SetRequestID(id string) *Request {
+	return req.setHeader(DefaultRequestIDHeader, id)
+}
+
+// SetIfNoneMatch makes the request conditional on the given entity tag, as
+// returned in the ETag header of a previous response, no longer matching the
+// resource. GetBody reports a NotModified error if the resource is unchanged.
+func (req *Request) SetIfNoneMatch(etag string) *Request {
+	return req.setHeader("If-None-Match", etag)
+}
+
+// SetIfModifiedSince makes the request conditional on the resource having been
+// modified after the given time. GetBody reports a NotModified error if the
+// resource is unchanged.
+func (req *Request) SetIfModifiedSince(since time.Time) *Request {
+	return req.setHeader("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+}
+
+// setHeader sets the given header, replacing any previous values.
+func (req *Request) setHeader(key, value string) *Request {
+	if req.Header != nil {
+		req.Header.Del(key)
+	}
+	return req.AddHeader(key, value)
+}
+
 // AddHeader adds the given header to the request.
 func (req *Request) AddHeader(key, value string) *Request {
 	if req.Header == nil {
@@ -198,10 +472,26 @@ func (req *Request) AddHeader(key, value string) *Request {
 	return req
 }
 
-// SetBody marshals the given objects and sets it as the body of the
-// request. The Content-Length header will be automatically set.
+// SetCodec selects the codec used to marshal the body of the request and to
+// unmarshal the body of the response. The Accept header is set to the content
+// type of the codec. Must be called before SetBody.
+func (req *Request) SetCodec(codec Codec) *Request {
+	req.Codec = codec
+	return req.setHeader("Accept", codec.ContentType())
+}
+
+func (req *Request) codec() Codec {
+	if req == nil || req.Codec == nil {
+		return JSONCodec
+	}
+	return req.Codec
+}
+
+// SetBody marshals the given objects using the codec of the request and sets
+// it as the body of the request. The Content-Length and Content-Type headers
+// will be automatically set.
 func (req *Request) SetBody(obj interface{}) *Request {
-	if js, err := json.Marshal(obj); err == nil {
+	if js, err := req.codec().Marshal(obj); err == nil {
 
 		if req.GzipLevel != 0 {
 			var body bytes.Buffer
@@ -216,7 +506,6 @@ func (req *Request) SetBody(obj interface{}) *Request {
 		} else {
 			req.Body = js
 		}
-		req.AddHeader("Content-Length", strconv.Itoa(len(req.Body)))
 
 	} else {
 		req.err = &Error{MarshalError, err}
@@ -225,63 +514,459 @@ func (req *Request) SetBody(obj interface{}) *Request {
 	return req
 }
 
+// SetBodyReader streams the body of the request from the given reader which
+// avoids buffering large uploads in memory. A negative content length leaves
+// the Content-Length header unset and relies on chunked transfer encoding. The
+// reader is not closed by the request.
+//
+// Requests with a reader body are only retried if the reader implements
+// io.Seeker, in which case it's rewound to its current position before each
+// attempt.
+func (req *Request) SetBodyReader(reader io.Reader, contentLength int64) *Request {
+	req.BodyReader = reader
+	req.ContentLength = contentLength
+
+	if seeker, ok := reader.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			req.err = &Error{ReadBodyError, err}
+		}
+		req.bodyOffset = offset
+	}
+
+	return req
+}
+
+// SetUploadProgress sets a callback which is invoked as the body of the request
+// is sent, typically to display a progress bar. The total is known when the
+// body was set via SetBody or SetBodyRaw or when a content length was given to
+// SetBodyReader.
+func (req *Request) SetUploadProgress(fn func(sent, total int64)) *Request {
+	req.UploadProgress = fn
+	return req
+}
+
+// SetBodyRaw sets the given data as is as the body of the request along with its
+// content type. This allows sending non-JSON payloads like form data or
+// protobufs. The Content-Length header will be automatically set.
+func (req *Request) SetBodyRaw(data []byte, contentType string) *Request {
+	req.Body = data
+	req.ContentType = contentType
+	return req
+}
+
+// SetFormBody encodes the given values as the body of the request using the
+// application/x-www-form-urlencoded content type expected by HTML forms.
+func (req *Request) SetFormBody(values url.Values) *Request {
+	return req.SetBodyRaw([]byte(values.Encode()), "application/x-www-form-urlencoded")
+}
+
+// SetMultipart sets the body of the request to a multipart/form-data form made
+// of the given fields and files, where each file is sent under its key as both
+// the name of the form field and the file name. The files are streamed as the
+// body is sent and the Content-Length is only set if the sizes of all the
+// files are known, either because they implement a Len method like
+// bytes.Reader or because they implement io.Seeker like os.File.
+func (req *Request) SetMultipart(fields map[string]string, files map[string]io.Reader) *Request {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	var parts []io.Reader
+	var contentLength int64
+	sized := true
+
+	// The headers of the parts are buffered between the files which are read
+	// as is.
+	flush := func() {
+		contentLength += int64(buffer.Len())
+		parts = append(parts, bytes.NewReader(append([]byte(nil), buffer.Bytes()...)))
+		buffer.Reset()
+	}
+
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writer.WriteField(name, fields[name])
+	}
+
+	names = names[:0]
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writer.CreateFormFile(name, name)
+		flush()
+
+		parts = append(parts, files[name])
+		if size, ok := readerSize(files[name]); ok {
+			contentLength += size
+		} else {
+			sized = false
+		}
+	}
+
+	writer.Close()
+	flush()
+
+	if !sized {
+		contentLength = -1
+	}
+
+	req.SetBodyReader(io.MultiReader(parts...), contentLength)
+	req.ContentType = writer.FormDataContentType()
+	return req
+}
+
+// readerSize returns the number of bytes left to be read from the given reader
+// if it can be determined without reading it.
+func readerSize(reader io.Reader) (int64, bool) {
+	if sized, ok := reader.(interface{ Len() int }); ok {
+		return int64(sized.Len()), true
+	}
+
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if _, err2 := seeker.Seek(offset, io.SeekStart); err != nil || err2 != nil {
+		return 0, false
+	}
+	return end - offset, true
+}
+
 func (req *Request) SetRawBody(obj json.RawMessage) *Request {
 	req.Body = obj
-	req.AddHeader("Content-Length", strconv.Itoa(len(obj)))
 	return req
 }
 
+// path returns the path of the request which defaults to Root.
+func (req *Request) path() string {
+	if len(req.Path) == 0 {
+		return req.Root
+	}
+	return req.Path
+}
+
+// Validate checks the request for common misconfigurations such as a missing
+// host, an invalid method, a relative path or a body on a GET or HEAD request.
+// It's called automatically by Send which then returns the error without
+// sending the request.
+func (req *Request) Validate() *Error {
+	if len(req.Host) == 0 {
+		return ErrorFmt(InvalidRequestError, "missing host")
+	}
+
+	if req.Client == nil {
+		return ErrorFmt(InvalidRequestError, "missing http client")
+	}
+
+	if len(req.Method) == 0 {
+		return ErrorFmt(InvalidRequestError, "missing method")
+	}
+
+	for _, c := range req.Method {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return ErrorFmt(InvalidRequestError, "invalid method: '%s'", req.Method)
+		}
+	}
+
+	if path := req.path(); len(path) > 0 && path[0] != '/' {
+		return ErrorFmt(InvalidRequestError, "path must be absolute: '%s'", path)
+	}
+
+	if (req.Method == "GET" || req.Method == "HEAD") && (len(req.Body) > 0 || req.BodyReader != nil) {
+		return ErrorFmt(InvalidRequestError, "unexpected body for %s request", req.Method)
+	}
+
+	return nil
+}
+
+// Clone returns a copy of the request which can be modified and sent
+// independently of the original. The Header, Query, Body and RetryCodes fields
+// are deep-copied while the BodyReader and Context are shared.
+func (req *Request) Clone() *Request {
+	clone := *req
+	clone.HTTP = nil
+	clone.Header = req.Header.Clone()
+
+	if req.Query != nil {
+		clone.Query = make(url.Values, len(req.Query))
+		for key, values := range req.Query {
+			clone.Query[key] = append([]string(nil), values...)
+		}
+	}
+
+	if req.Body != nil {
+		clone.Body = append([]byte(nil), req.Body...)
+	}
+
+	if req.RetryCodes != nil {
+		clone.RetryCodes = append([]int(nil), req.RetryCodes...)
+	}
+
+	return &clone
+}
+
 // Send attempts to send the request to the remote endpoint and returns a
-// Response which contains the result.
+// Response which contains the result. The request can be sent multiple times
+// but only the HTTP field is updated by each send so concurrent sends of the
+// same request should use Clone.
 func (req *Request) Send() *Response {
 	t0 := time.Now()
 
-	if len(req.Path) == 0 {
-		req.Path = req.Root
-	}
-
 	resp := &Response{Request: req, Error: req.err}
+	if resp.Error == nil {
+		resp.Error = req.Validate()
+	}
 
 	if resp.Error == nil {
-		if req.REST != nil {
-			req.REST.begin()
-		}
+		for {
+			if resp.stream != nil {
+				resp.stream.Close()
+			}
+			*resp = Response{Request: req, Attempts: resp.Attempts + 1}
+
+			if req.REST != nil {
+				req.REST.begin()
+			}
 
-		req.send(resp)
+			req.send(resp)
 
-		if req.REST != nil {
-			req.REST.end()
+			if req.REST != nil {
+				req.REST.end()
+			}
+
+			if resp.Attempts > req.Retries || !req.retryable(resp) || !req.backoff(resp) {
+				break
+			}
 		}
 	}
 
 	resp.Latency = time.Since(t0)
+
+	if req.REST != nil && req.REST.Observer != nil {
+		req.REST.Observer(resp)
+	}
+
 	return resp
 }
 
+func (req *Request) retryable(resp *Response) bool {
+	switch req.Method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS", "TRACE":
+	default:
+		return false
+	}
+
+	if _, ok := req.BodyReader.(io.Seeker); req.BodyReader != nil && !ok {
+		return false
+	}
+
+	if resp.Error != nil {
+		return resp.Error.Type == SendRequestError
+	}
+
+	if req.RespectRetryAfter && resp.Code == http.StatusTooManyRequests {
+		return true
+	}
+
+	codes := req.RetryCodes
+	if codes == nil {
+		codes = DefaultRetryCodes
+	}
+
+	for _, code := range codes {
+		if resp.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter parses the value of a Retry-After header which is either a
+// number of seconds or an HTTP date. Dates in the past result in no delay.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// backoff waits before retrying the given response and returns false if the
+// context of the request was done in the meantime.
+func (req *Request) backoff(resp *Response) bool {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	delay := req.RetryBackoff << uint(resp.Attempts-1)
+
+	if req.RespectRetryAfter && (resp.Code == http.StatusTooManyRequests || resp.Code == http.StatusServiceUnavailable) {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			max := req.MaxRetryAfter
+			if max == 0 {
+				max = DefaultMaxRetryAfter
+			}
+			if delay = retryAfter; delay > max {
+				delay = max
+			}
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (req *Request) send(resp *Response) {
 	var reader io.Reader
-	if len(req.Body) > 0 {
+	if req.BodyReader != nil {
+		if seeker, ok := req.BodyReader.(io.Seeker); ok && resp.Attempts > 1 {
+			if _, err := seeker.Seek(req.bodyOffset, io.SeekStart); err != nil {
+				resp.Error = &Error{ReadBodyError, err}
+				return
+			}
+		}
+		reader = ioutil.NopCloser(req.BodyReader)
+
+	} else if len(req.Body) > 0 {
 		reader = bytes.NewReader(req.Body)
 	}
 
-	urlS := strings.TrimRight(req.Host, "/") + req.Path
+	contentLength := req.ContentLength
+	if req.BodyReader == nil {
+		contentLength = int64(len(req.Body))
+	}
+
+	if reader != nil && req.UploadProgress != nil {
+		reader = &progressReader{ReadCloser: ioutil.NopCloser(reader), total: contentLength, progress: req.UploadProgress}
+	}
+
+	urlS := strings.TrimRight(req.Host, "/") + req.path()
 
 	if req.Query != nil {
 		urlS += "?" + req.Query.Encode()
 	}
 
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if req.REST != nil && req.REST.pool != nil {
+		ctx = httptrace.WithClientTrace(ctx, req.REST.pool.trace())
+	}
+
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+
+		// Streamed bodies are still being read once send returns so the
+		// timeout is only released when the stream is closed.
+		defer func() {
+			if resp.stream != nil {
+				resp.stream = &cancelReadCloser{resp.stream, cancel}
+			} else {
+				cancel()
+			}
+		}()
+	}
+
 	var err error
 
-	if req.HTTP, err = http.NewRequest(req.Method, urlS, reader); err != nil {
+	if req.HTTP, err = http.NewRequestWithContext(ctx, req.Method, urlS, reader); err != nil {
 		resp.Error = &Error{NewRequestError, err}
 		return
 	}
 
-	req.AddHeader("Content-Type", "application/json")
-	req.HTTP.Header = req.Header
+	if reader != nil {
+		req.HTTP.ContentLength = contentLength
+		if contentLength < 0 {
+			req.HTTP.ContentLength = -1
+		}
+	}
+
+	// The headers are copied so that the request can be sent again.
+	header := req.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	if id := RequestID(ctx); len(id) > 0 && len(header.Get(DefaultRequestIDHeader)) == 0 {
+		header.Set(DefaultRequestIDHeader, id)
+	}
+
+	// The length is derived from the body when the request is written so a
+	// manually set header could only disagree with it.
+	header.Del("Content-Length")
+
+	// Requests without a body don't have a content type which some servers
+	// are strict about.
+	if reader != nil {
+		if len(req.ContentType) > 0 {
+			header.Set("Content-Type", req.ContentType)
+		} else if _, ok := header["Content-Type"]; !ok {
+			header.Set("Content-Type", req.codec().ContentType())
+		}
+	}
+	req.HTTP.Header = header
 
-	httpResp, err := req.Client.Do(req.HTTP)
+	if req.SignFunc != nil {
+		if key, value := req.SignFunc(req); len(key) > 0 {
+			header.Set(key, value)
+		}
+	}
+
+	httpClient := req.Client
+	if req.CheckRedirect != nil {
+		httpClient = new(http.Client)
+		*httpClient = *req.Client
+		httpClient.CheckRedirect = req.CheckRedirect
+	}
+
+	httpResp, err := httpClient.Do(req.HTTP)
 	if err != nil {
+		if req.Context != nil && req.Context.Err() != nil {
+			resp.Error = &Error{ContextError, err}
+			return
+		}
+
 		if err2, ok := err.(*url.Error); ok {
 			if err3, ok := err2.Err.(net.Error); ok {
 				if err3.Timeout() {
@@ -294,17 +979,80 @@ func (req *Request) send(resp *Response) {
 		return
 	}
 
+	defer func() {
+		if resp.stream == nil {
+			httpResp.Body.Close()
+		}
+	}()
+
 	resp.Code = httpResp.StatusCode
 	resp.Header = httpResp.Header
 
-	if resp.Body, err = ioutil.ReadAll(httpResp.Body); err != nil {
-		resp.Error = &Error{ReadBodyError, err}
+	resp.HTTP = new(http.Response)
+	*resp.HTTP = *httpResp
+	resp.HTTP.Body = http.NoBody
+
+	if req.StreamResponse {
+		resp.stream = httpResp.Body
+		return
 	}
 
-	httpResp.Body.Close()
+	resp.readBody(httpResp.Body)
+	resp.HTTP.Body = ioutil.NopCloser(bytes.NewReader(resp.Body))
+
+	// The timeout can also expire while reading the body in which case it
+	// should be reported the same way as a timeout during the round-trip.
+	if resp.Error != nil && resp.Error.Type == ReadBodyError && ctx.Err() != nil {
+		if req.Context != nil && req.Context.Err() != nil {
+			resp.Error = &Error{ContextError, resp.Error.Sub}
+		} else {
+			resp.Error = &Error{TimeoutError, resp.Error.Sub}
+		}
+	}
 	return
 }
 
+// progressReader reports the progress of the body of a request as it's read by
+// the transport.
+type progressReader struct {
+	io.ReadCloser
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (reader *progressReader) Read(buffer []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(buffer)
+	if n > 0 {
+		reader.sent += int64(n)
+		reader.progress(reader.sent, reader.total)
+	}
+	return n, err
+}
+
+// cancelReadCloser releases the context of a streamed response once closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (reader *cancelReadCloser) Close() error {
+	defer reader.cancel()
+	return reader.ReadCloser.Close()
+}
+
+// Do sends the request and unmarshals the body of the response into a new
+// value of type T. If an error is detected then the zero value of T is returned
+// along with the error. See Response.GetBody for the error conditions.
+func Do[T any](req *Request) (T, *Error) {
+	var obj T
+	if err := req.Send().GetBody(&obj); err != nil {
+		var zero T
+		return zero, err
+	}
+	return obj, nil
+}
+
 // Response holds the result of a sent REST request. The response should be read
 // via the GetBody method which checks the various fields to detect errors.
 type Response struct {
@@ -325,40 +1073,122 @@ type Response struct {
 	// Error is set if an error occured while sending the request.
 	Error *Error
 
-	// Latency indicates how long the request round-trip took.
+	// HTTP is the HTTP response returned by the endpoint which exposes
+	// details such as its trailers, protocol or TLS state. Its body was
+	// already read into Body and is replaced by a reader over Body, or by
+	// http.NoBody for streamed responses whose body is available via
+	// BodyReader. Nil if the request failed before a response was received.
+	HTTP *http.Response
+
+	// stream is the open body of the HTTP response when streaming is enabled
+	// and until it's read by GetBody.
+	stream io.ReadCloser
+
+	// Latency indicates how long the request round-trip took, including all
+	// the attempts.
 	Latency time.Duration
+
+	// Attempts is the number of times the request was sent.
+	Attempts int
+}
+
+// BodyReader returns the body of the HTTP response as a stream. If streaming
+// was enabled via Request.SetStreamResponse then the reader is the open body of
+// the HTTP response which the caller MUST close; content encodings that were
+// not handled by the transport are not decoded. Otherwise the reader is
+// over the buffered Response.Body.
+func (resp *Response) BodyReader() io.ReadCloser {
+	if resp.stream != nil {
+		return resp.stream
+	}
+	return ioutil.NopCloser(bytes.NewReader(resp.Body))
+}
+
+// readBody buffers the given body in Response.Body, decoding any content
+// encodings.
+func (resp *Response) readBody(body io.Reader) {
+	var err error
+	if resp.Body, err = ioutil.ReadAll(body); err != nil {
+		resp.Error = &Error{ReadBodyError, err}
+
+	} else if encodings := resp.Header.Values("Content-Encoding"); len(encodings) > 0 && len(resp.Body) > 0 {
+		if resp.Body, err = decodeBodyEncodings(encodings, resp.Body); err != nil {
+			resp.Error = &Error{ContentEncodingError, err}
+		} else {
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+		}
+	}
+}
+
+// codec returns the codec matching the content type of the response which is
+// either the codec of the request or JSONCodec. If the content type is missing
+// or unknown, the codec of the request is returned along with false.
+func (resp *Response) codec() (Codec, bool) {
+	codec := resp.Request.codec()
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return codec, false
+	}
+
+	if mediaType == codec.ContentType() {
+		return codec, true
+	}
+	if mediaType == JSONCodec.ContentType() {
+		return JSONCodec, true
+	}
+	return codec, false
 }
 
 // GetBody checks the various fields of the response for errors and unmarshals
 // the response body if the given object is not nil. If an error is detected,
-// the error type and error will be returned instead.
+// the error type and error will be returned instead. Responses to HEAD requests
+// are never unmarshalled and only their status code is checked. A 304 response
+// to a conditional request is reported as a NotModified error and leaves obj
+// untouched.
 func (resp *Response) GetBody(obj interface{}) (err *Error) {
+	if resp.stream != nil {
+		stream := resp.stream
+		resp.stream = nil
+		resp.readBody(stream)
+		stream.Close()
+	}
+
 	if resp.Error != nil {
 		err = resp.Error
 
+	} else if resp.Code == http.StatusNotModified {
+		err = ErrorFmt(NotModified, "not modified")
+
 	} else if resp.Code == http.StatusNotFound {
 		err = &Error{UnknownRoute, errors.New(string(resp.Body))}
 
 	} else if resp.Code >= 400 {
 		err = &Error{EndpointError, errors.New(string(resp.Body))}
 
-	} else if resp.Code < 200 && resp.Code >= 300 {
+	} else if resp.Code < 200 || resp.Code >= 300 {
 		err = ErrorFmt(UnexpectedStatusCode, "unexpected status code: %d", resp.Code)
 
+	} else if resp.Request != nil && resp.Request.Method == "HEAD" {
+		// HEAD responses only carry headers so there's nothing to unmarshal.
+		return
+
 	} else if resp.Code == http.StatusNoContent {
 		if obj == nil {
 			return
 		}
 		err = ErrorFmt(UnexpectedStatusCode, "unexpected status code: 204")
 
-	} else if contentType := resp.Header.Get("Content-Type"); len(resp.Body) > 0 && contentType != "application/json" {
-		err = ErrorFmt(UnsupportedContentType, "unsupported content-type: '%s' != 'application/json'", contentType)
+	} else if codec, ok := resp.codec(); len(resp.Body) > 0 && !ok {
+		err = ErrorFmt(UnsupportedContentType, "unsupported content-type: '%s' != '%s'",
+			resp.Header.Get("Content-Type"), codec.ContentType())
 
 	} else if obj == nil {
 		return
 
-	} else if jsonErr := json.Unmarshal(resp.Body, obj); jsonErr != nil {
-		err = &Error{UnmarshalError, jsonErr}
+	} else if codecErr := codec.Unmarshal(resp.Body, obj); codecErr != nil {
+		err = &Error{UnmarshalError, codecErr}
 	}
 
 	return
@@ -0,0 +1,1174 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newDelayServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		time.Sleep(delay)
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := newDelayServer(50 * time.Millisecond)
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Timeout: 10 * time.Millisecond}
+
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(nil); err == nil || err.Type != TimeoutError {
+		t.Errorf("FAIL(default): expected timeout error: %v", err)
+	}
+
+	r1 := client.NewRequest("GET").SetTimeout(time.Second).Send()
+	checkResp(t, "override", r1)
+
+	r2 := client.NewRequest("GET").SetTimeout(0).Send()
+	checkResp(t, "disabled", r2)
+}
+
+func TestDo(t *testing.T) {
+	handler := &TestService{}
+
+	mux := new(Mux)
+	mux.AddService(handler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Root: "/map/"}
+	checkResp(t, "p(a,1)", client.NewRequest("POST").SetBody(&KV{"a", "1"}).Send())
+
+	kv, err := Do[KV](client.NewRequest("GET").SetPath("/a"))
+	if err != nil {
+		t.Errorf("FAIL(g(a)): unexpected error: %s", err)
+	} else if kv.Key != "a" || kv.Val != "1" {
+		t.Errorf("FAIL(g(a)): value mismatch '%s:%s' != 'a:1'", kv.Key, kv.Val)
+	}
+
+	ptr, err := Do[*KV](client.NewRequest("GET").SetPath("/b"))
+	if err == nil || err.Type != EndpointError {
+		t.Errorf("FAIL(g(b)): unexpected error: %v", err)
+	} else if ptr != nil {
+		t.Errorf("FAIL(g(b)): expected zero value: %v", ptr)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	server := newDelayServer(50 * time.Millisecond)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	r0 := client.NewRequest("GET").SetContext(ctx).Send()
+	if err := r0.GetBody(nil); err == nil || err.Type != ContextError {
+		t.Errorf("FAIL(cancel): expected context error: %v", err)
+	} else if !errors.Is(err.Sub, context.Canceled) {
+		t.Errorf("FAIL(cancel): expected cancelled error: %v", err.Sub)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	r1 := client.NewRequest("GET").SetContext(ctx).Send()
+	if err := r1.GetBody(nil); err == nil || err.Type != ContextError {
+		t.Errorf("FAIL(deadline): expected context error: %v", err)
+	}
+
+	r2 := client.NewRequest("GET").SetContext(context.Background()).Send()
+	checkResp(t, "background", r2)
+}
+
+func TestResponseHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		if httpReq.URL.Path != "/exists" {
+			http.NotFound(writer, httpReq)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Length", "42")
+		writer.Header().Set("X-Exists", "yes")
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("HEAD").SetPath("/exists").Send()
+	checkResp(t, "head", r0)
+
+	var kv KV
+	if err := r0.GetBody(&kv); err != nil {
+		t.Errorf("FAIL(head): unexpected error: %s", err)
+	}
+
+	if r0.Code != http.StatusOK || r0.Header.Get("X-Exists") != "yes" {
+		t.Errorf("FAIL(head): unexpected response: %d %v", r0.Code, r0.Header)
+	}
+
+	r1 := client.NewRequest("HEAD").SetPath("/missing").Send()
+	failResp(t, "head-missing", r1, UnknownRoute, http.StatusNotFound)
+}
+
+func TestResponseUnexpectedStatusCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusMultipleChoices)
+		writer.Write([]byte(`{"key":"a","val":"1"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var kv KV
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(&kv); err == nil || err.Type != UnexpectedStatusCode {
+		t.Errorf("FAIL(3xx): expected unexpected status code error: %v", err)
+	}
+
+	r1 := &Response{Code: http.StatusContinue, Header: make(http.Header)}
+	if err := r1.GetBody(nil); err == nil || err.Type != UnexpectedStatusCode {
+		t.Errorf("FAIL(1xx): expected unexpected status code error: %v", err)
+	}
+}
+
+func TestResponseUnmarshalError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"key":"a","val":`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var kv KV
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(&kv); err == nil || err.Type != UnmarshalError {
+		t.Errorf("FAIL: expected unmarshal error: %v", err)
+	}
+}
+
+func TestResponseEmptyBodyNoContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var kv KV
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(&kv); err == nil || err.Type != UnmarshalError {
+		t.Errorf("FAIL: expected unmarshal error: %v", err)
+	}
+}
+
+func TestResponseContentTypeParams(t *testing.T) {
+	var contentType string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", contentType)
+		writer.Write([]byte(`{"key":"a","val":"1"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	for _, contentType = range []string{"application/json; charset=utf-8", " application/json ", "application/json;charset=\"utf-8\""} {
+		checkRespBody(t, contentType, client.NewRequest("GET").Send(), &KV{"a", "1"})
+	}
+
+	for _, contentType = range []string{"text/plain; charset=utf-8", "application/json; charset"} {
+		var kv KV
+		if err := client.NewRequest("GET").Send().GetBody(&kv); err == nil || err.Type != UnsupportedContentType {
+			t.Errorf("FAIL(%s): expected unsupported content type error: %v", contentType, err)
+		}
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	var path string
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		path = httpReq.Method + " " + httpReq.URL.Path
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	client := &Client{Host: healthy.URL, Root: "/api"}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("FAIL(healthy): unexpected error: %s", err)
+	} else if path != "HEAD /" {
+		t.Errorf("FAIL(healthy): unexpected request: '%s'", path)
+	}
+
+	client = &Client{Host: healthy.URL, HealthPath: "/health"}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("FAIL(health-path): unexpected error: %s", err)
+	} else if path != "HEAD /health" {
+		t.Errorf("FAIL(health-path): unexpected request: '%s'", path)
+	}
+
+	client = &Client{Host: unhealthy.URL}
+	if err := client.Ping(context.Background()); err == nil {
+		t.Errorf("FAIL(unhealthy): expected error")
+	}
+}
+
+func TestRequestRetry(t *testing.T) {
+	var count int
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		body, _ := ioutil.ReadAll(httpReq.Body)
+		bodies = append(bodies, string(body))
+
+		if count++; count%3 != 0 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("PUT").SetBody(&KV{"a", "1"}).SetRetry(3, time.Millisecond).Send()
+	checkResp(t, "retry", r0)
+	if r0.Attempts != 3 {
+		t.Errorf("FAIL(retry): unexpected attempts: %d", r0.Attempts)
+	}
+	for i, body := range bodies {
+		if body != `{"key":"a","val":"1"}` {
+			t.Errorf("FAIL(retry): unexpected body for attempt %d: '%s'", i, body)
+		}
+	}
+
+	count = 0
+	r1 := client.NewRequest("GET").SetRetry(1, time.Millisecond).Send()
+	failResp(t, "exhausted", r1, EndpointError, http.StatusServiceUnavailable)
+	if r1.Attempts != 2 {
+		t.Errorf("FAIL(exhausted): unexpected attempts: %d", r1.Attempts)
+	}
+
+	count = 0
+	r2 := client.NewRequest("POST").SetBody(&KV{"a", "1"}).SetRetry(3, time.Millisecond).Send()
+	if r2.Attempts != 1 {
+		t.Errorf("FAIL(post): unexpected attempts: %d", r2.Attempts)
+	}
+
+	count = 0
+	r3 := client.NewRequest("GET").SetRetry(3, time.Millisecond).SetRetryCodes(http.StatusBadGateway).Send()
+	if r3.Attempts != 1 {
+		t.Errorf("FAIL(codes): unexpected attempts: %d", r3.Attempts)
+	}
+
+	server.Close()
+
+	r4 := client.NewRequest("GET").SetRetry(2, time.Millisecond).Send()
+	if err := r4.GetBody(nil); err == nil || err.Type != SendRequestError {
+		t.Errorf("FAIL(conn): expected send request error: %v", err)
+	}
+	if r4.Attempts != 3 {
+		t.Errorf("FAIL(conn): unexpected attempts: %d", r4.Attempts)
+	}
+}
+
+func TestRequestSetBodyRaw(t *testing.T) {
+	var contentType, body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		contentType = httpReq.Header.Get("Content-Type")
+		data, _ := ioutil.ReadAll(httpReq.Body)
+		body = string(data)
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	checkResp(t, "raw", client.NewRequest("POST").SetBodyRaw([]byte("hello world"), "text/plain").Send())
+	if contentType != "text/plain" || body != "hello world" {
+		t.Errorf("FAIL(raw): unexpected request: '%s' '%s'", contentType, body)
+	}
+
+	checkResp(t, "json", client.NewRequest("POST").SetBody(&KV{"a", "1"}).Send())
+	if contentType != "application/json" || body != `{"key":"a","val":"1"}` {
+		t.Errorf("FAIL(json): unexpected request: '%s' '%s'", contentType, body)
+	}
+}
+
+func TestRequestSetBodyReader(t *testing.T) {
+	var count int
+	var fail bool
+	var length int64
+	var encoding []string
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		length, encoding = httpReq.ContentLength, httpReq.TransferEncoding
+		body, _ := ioutil.ReadAll(httpReq.Body)
+		bodies = append(bodies, string(body))
+
+		if count++; fail && count == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+	payload := strings.Repeat("a", 1000)
+
+	checkResp(t, "length", client.NewRequest("PUT").SetBodyReader(strings.NewReader(payload), 1000).Send())
+	if length != 1000 || len(encoding) != 0 || bodies[0] != payload {
+		t.Errorf("FAIL(length): unexpected request: %d %v %d", length, encoding, len(bodies[0]))
+	}
+
+	bodies = nil
+	checkResp(t, "chunked", client.NewRequest("PUT").SetBodyReader(strings.NewReader(payload), -1).Send())
+	if length != -1 || len(encoding) != 1 || encoding[0] != "chunked" || bodies[0] != payload {
+		t.Errorf("FAIL(chunked): unexpected request: %d %v %d", length, encoding, len(bodies[0]))
+	}
+
+	count, fail, bodies = 0, true, nil
+	reader := strings.NewReader("skip" + payload)
+	reader.Seek(4, io.SeekStart)
+
+	r0 := client.NewRequest("PUT").SetBodyReader(reader, 1000).SetRetry(1, time.Millisecond).Send()
+	checkResp(t, "seeker", r0)
+	if r0.Attempts != 2 || len(bodies) != 2 || bodies[0] != payload || bodies[1] != payload {
+		t.Errorf("FAIL(seeker): unexpected attempts: %d %d", r0.Attempts, len(bodies))
+	}
+
+	count, bodies = 0, nil
+	r1 := client.NewRequest("PUT").SetBodyReader(io.LimitReader(strings.NewReader(payload), 1000), 1000).SetRetry(1, time.Millisecond).Send()
+	failResp(t, "non-seeker", r1, EndpointError, http.StatusServiceUnavailable)
+	if r1.Attempts != 1 {
+		t.Errorf("FAIL(non-seeker): unexpected attempts: %d", r1.Attempts)
+	}
+}
+
+func TestResponseContentEncoding(t *testing.T) {
+	deflate := func(body []byte) []byte {
+		buffer := new(bytes.Buffer)
+		writer := zlib.NewWriter(buffer)
+		writer.Write(body)
+		writer.Close()
+		return buffer.Bytes()
+	}
+
+	gzipped := func(body []byte) []byte {
+		buffer := new(bytes.Buffer)
+		writer := gzip.NewWriter(buffer)
+		writer.Write(body)
+		writer.Close()
+		return buffer.Bytes()
+	}
+
+	var encoding string
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Encoding", encoding)
+		writer.Write(body)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+	js := []byte(`{"key":"a","val":"1"}`)
+
+	encoding, body = "deflate", deflate(js)
+	r0 := client.NewRequest("GET").Send()
+	checkRespBody(t, "deflate", r0, &KV{"a", "1"})
+	if value := r0.Header.Get("Content-Encoding"); value != "" {
+		t.Errorf("FAIL(deflate): unexpected content encoding: '%s'", value)
+	}
+
+	encoding, body = "deflate, gzip", gzipped(deflate(js))
+	checkRespBody(t, "deflate-gzip", client.NewRequest("GET").Send(), &KV{"a", "1"})
+
+	encoding, body = "br", js
+	if err := client.NewRequest("GET").Send().GetBody(nil); err == nil || err.Type != ContentEncodingError {
+		t.Errorf("FAIL(unsupported): expected content encoding error: %v", err)
+	}
+}
+
+func TestResponseStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"key":"a","val":"1"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Timeout: time.Second}
+
+	r0 := client.NewRequest("GET").SetStreamResponse(true).Send()
+	if len(r0.Body) != 0 {
+		t.Errorf("FAIL(stream): unexpected buffered body: %s", r0.Body)
+	}
+
+	reader := r0.BodyReader()
+	body, err := ioutil.ReadAll(reader)
+	reader.Close()
+
+	if err != nil {
+		t.Errorf("FAIL(stream): unexpected error: %s", err)
+	} else if string(body) != `{"key":"a","val":"1"}` {
+		t.Errorf("FAIL(stream): unexpected body: %s", body)
+	}
+
+	checkRespBody(t, "get-body", client.NewRequest("GET").SetStreamResponse(true).Send(), &KV{"a", "1"})
+
+	r1 := client.NewRequest("GET").Send()
+	if body, _ := ioutil.ReadAll(r1.BodyReader()); string(body) != `{"key":"a","val":"1"}` {
+		t.Errorf("FAIL(buffered): unexpected body: %s", body)
+	}
+}
+
+func TestRequestUploadProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		ioutil.ReadAll(httpReq.Body)
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+	payload := strings.Repeat("a", 100000)
+
+	check := func(title string, req *Request, total int64) {
+		var sent []int64
+		var totals []int64
+
+		req.SetUploadProgress(func(n, total int64) {
+			sent = append(sent, n)
+			totals = append(totals, total)
+		})
+		checkResp(t, title, req.Send())
+
+		if len(sent) == 0 {
+			t.Errorf("FAIL(%s): progress callback never invoked", title)
+			return
+		}
+
+		for i := range sent {
+			if i > 0 && sent[i] <= sent[i-1] {
+				t.Errorf("FAIL(%s): sent is not increasing: %v", title, sent)
+				break
+			}
+			if totals[i] != total {
+				t.Errorf("FAIL(%s): unexpected total: %d != %d", title, totals[i], total)
+				break
+			}
+		}
+
+		if last := sent[len(sent)-1]; last != int64(len(payload)) {
+			t.Errorf("FAIL(%s): unexpected final sent value: %d", title, last)
+		}
+	}
+
+	check("reader", client.NewRequest("PUT").SetBodyReader(strings.NewReader(payload), int64(len(payload))), int64(len(payload)))
+	check("chunked", client.NewRequest("PUT").SetBodyReader(strings.NewReader(payload), -1), -1)
+	check("raw", client.NewRequest("PUT").SetBodyRaw([]byte(payload), "text/plain"), int64(len(payload)))
+}
+
+func TestRequestSetAcceptGzip(t *testing.T) {
+	var accept string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		accept = httpReq.Header.Get("Accept-Encoding")
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Encoding", "gzip")
+
+		gz := gzip.NewWriter(writer)
+		gz.Write([]byte(`{"key":"a","val":"1"}`))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("GET").SetAcceptGzip().Send()
+	checkRespBody(t, "gzip", r0, &KV{"a", "1"})
+
+	if accept != "gzip" {
+		t.Errorf("FAIL(gzip): unexpected accept encoding: '%s'", accept)
+	}
+	if value := r0.Header.Get("Content-Encoding"); value != "" {
+		t.Errorf("FAIL(gzip): unexpected content encoding: '%s'", value)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	return fn(httpReq)
+}
+
+type failingBody struct {
+	reader io.Reader
+	closed bool
+}
+
+func (body *failingBody) Read(buffer []byte) (int, error) {
+	n, err := body.reader.Read(buffer)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (body *failingBody) Close() error {
+	body.closed = true
+	return nil
+}
+
+func TestResponseBodyCloseOnReadError(t *testing.T) {
+	var body *failingBody
+
+	transport := roundTripperFunc(func(httpReq *http.Request) (*http.Response, error) {
+		body = &failingBody{reader: strings.NewReader(`{"key":`)}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       body,
+		}, nil
+	})
+
+	client := &Client{Client: &http.Client{Transport: transport}, Host: "http://localhost"}
+
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(nil); err == nil || err.Type != ReadBodyError {
+		t.Errorf("FAIL(buffered): expected read body error: %v", err)
+	}
+	if !body.closed {
+		t.Errorf("FAIL(buffered): body was not closed")
+	}
+
+	r1 := client.NewRequest("GET").SetStreamResponse(true).Send()
+	if body.closed {
+		t.Errorf("FAIL(stream): body closed before being read")
+	}
+	if err := r1.GetBody(nil); err == nil || err.Type != ReadBodyError {
+		t.Errorf("FAIL(stream): expected read body error: %v", err)
+	}
+	if !body.closed {
+		t.Errorf("FAIL(stream): body was not closed")
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	check := func(title string, req *Request, valid bool) {
+		err := req.Validate()
+		if valid && err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", title, err)
+		} else if !valid && (err == nil || err.Type != InvalidRequestError) {
+			t.Errorf("FAIL(%s): expected invalid request error: %v", title, err)
+		}
+
+		if !valid {
+			if resp := req.Send(); resp.Error == nil || resp.Error.Type != InvalidRequestError || resp.Attempts != 0 {
+				t.Errorf("FAIL(%s): request was sent: %v", title, resp.Error)
+			}
+		}
+	}
+
+	host := "http://localhost"
+
+	check("valid", NewRequest(host, "GET").SetPath("/a"), true)
+	check("no-path", NewRequest(host, "GET"), true)
+	check("post-body", NewRequest(host, "POST").SetBody(&KV{"a", "1"}), true)
+	check("custom-method", NewRequest(host, "PROPFIND"), true)
+
+	check("empty-host", NewRequest("", "GET"), false)
+	check("no-client", &Request{Host: host, Method: "GET"}, false)
+	check("empty-method", NewRequest(host, ""), false)
+	check("invalid-method", NewRequest(host, "GET /"), false)
+	check("relative-path", &Request{Host: host, Method: "GET", Client: http.DefaultClient, Path: "a/b"}, false)
+	check("get-body", NewRequest(host, "GET").SetBody(&KV{"a", "1"}), false)
+	check("head-reader", NewRequest(host, "HEAD").SetBodyReader(strings.NewReader("a"), 1), false)
+}
+
+func TestRequestSetBasicAuth(t *testing.T) {
+	var user, password string
+	var ok bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		user, password, ok = httpReq.BasicAuth()
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	checkResp(t, "basic", client.NewRequest("GET").SetBasicAuth("bob", "s3cr:t").Send())
+	if !ok || user != "bob" || password != "s3cr:t" {
+		t.Errorf("FAIL(basic): unexpected credentials: %v '%s' '%s'", ok, user, password)
+	}
+
+	req := NewRequest(server.URL, "GET").AddHeader("X-Other", "a").SetBasicAuth("a", "b").SetBasicAuth("alice", "pw")
+	if values := req.Header.Values("Authorization"); len(values) != 1 {
+		t.Errorf("FAIL(overwrite): unexpected authorization headers: %v", values)
+	}
+
+	checkResp(t, "overwrite", req.Send())
+	if !ok || user != "alice" || password != "pw" {
+		t.Errorf("FAIL(overwrite): unexpected credentials: %v '%s' '%s'", ok, user, password)
+	}
+}
+
+func TestRequestAuthHelpers(t *testing.T) {
+	req := NewRequest("http://localhost", "GET").
+		SetBearerToken("a").
+		SetBearerToken("b").
+		SetAPIKey("X-Api-Key", "c").
+		SetAPIKey("X-Api-Key", "d")
+
+	if values := req.Header.Values("Authorization"); len(values) != 1 || values[0] != "Bearer b" {
+		t.Errorf("FAIL(bearer): unexpected authorization headers: %v", values)
+	}
+
+	if values := req.Header.Values("X-Api-Key"); len(values) != 1 || values[0] != "d" {
+		t.Errorf("FAIL(api-key): unexpected api key headers: %v", values)
+	}
+}
+
+func TestClientTimeoutReadBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write([]byte(`{"key":`))
+		writer.(http.Flusher).Flush()
+
+		time.Sleep(50 * time.Millisecond)
+		writer.Write([]byte(`"a"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("GET").SetTimeout(10 * time.Millisecond).Send()
+	if err := r0.GetBody(nil); err == nil || err.Type != TimeoutError {
+		t.Errorf("FAIL(timeout): expected timeout error: %v", err)
+	}
+
+	var kv KV
+	r1 := client.NewRequest("GET").SetTimeout(time.Second).Send()
+	if err := r1.GetBody(&kv); err != nil || kv.Key != "a" {
+		t.Errorf("FAIL(no-timeout): unexpected response: %v %v", err, kv)
+	}
+
+	r2 := &Response{Code: http.StatusServiceUnavailable, Header: make(http.Header)}
+	if err := r2.GetBody(nil); err == nil || err.Type == TimeoutError {
+		t.Errorf("FAIL(5xx): expected endpoint error: %v", err)
+	}
+}
+
+func TestRequestClone(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/echo", "POST", func(httpReq *http.Request, kv KV) *KV {
+		return &KV{httpReq.Header.Get("X-Id"), kv.Val + ":" + httpReq.URL.Query().Get("q")}
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+	template := client.NewRequest("POST").SetPath("/echo").AddHeader("X-Common", "1").SetBody(&KV{"a", "b"})
+	template.AddParam("q", "x")
+
+	clone := template.Clone()
+	clone.Header.Set("X-Common", "2")
+	clone.Query.Set("q", "y")
+	clone.Body[0] = ' '
+
+	if template.Header.Get("X-Common") != "1" || template.Query.Get("q") != "x" || template.Body[0] != '{' {
+		t.Errorf("FAIL(independent): template modified by clone: %v %v '%s'", template.Header, template.Query, template.Body)
+	}
+
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+
+			id := strconv.Itoa(i)
+			req := template.Clone()
+			req.AddHeader("X-Id", id)
+			checkRespBody(t, "clone-"+id, req.Send(), &KV{id, "b:x"})
+		}(i)
+	}
+	group.Wait()
+
+	if _, ok := template.Header["X-Id"]; ok || template.HTTP != nil {
+		t.Errorf("FAIL(template): template modified by sends: %v", template.Header)
+	}
+}
+
+func TestRequestSendTwice(t *testing.T) {
+	var contentTypes [][]string
+
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/echo", "POST", func(httpReq *http.Request, kv KV) *KV {
+		contentTypes = append(contentTypes, httpReq.Header["Content-Type"])
+		return &kv
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Root: "/echo"}
+	req := client.NewRequest("POST").SetBody(&KV{"a", "b"})
+
+	checkRespBody(t, "first", req.Send(), &KV{"a", "b"})
+	checkRespBody(t, "second", req.Send(), &KV{"a", "b"})
+
+	if len(contentTypes) != 2 {
+		t.Fatalf("FAIL: unexpected number of requests: %d", len(contentTypes))
+	}
+	for i, values := range contentTypes {
+		if len(values) != 1 || values[0] != "application/json" {
+			t.Errorf("FAIL(%d): unexpected Content-Type headers: %v", i, values)
+		}
+	}
+
+	if _, ok := req.Header["Content-Type"]; ok || len(req.Path) != 0 {
+		t.Errorf("FAIL: request modified by send: '%s' %v", req.Path, req.Header)
+	}
+}
+
+func TestResponseHTTP(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/kv", "GET", func() *KV { return &KV{"a", "b"} }))
+
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	client := &Client{Client: server.Client(), Host: server.URL}
+
+	resp := client.NewRequest("GET").SetPath("/kv").Send()
+	checkRespBody(t, "tls", resp, &KV{"a", "b"})
+
+	if resp.HTTP == nil {
+		t.Fatalf("FAIL: missing HTTP response")
+	}
+
+	if resp.HTTP.TLS == nil || resp.HTTP.StatusCode != http.StatusOK || resp.HTTP.ProtoMajor < 1 {
+		t.Errorf("FAIL: unexpected HTTP response: %v %d %s", resp.HTTP.TLS, resp.HTTP.StatusCode, resp.HTTP.Proto)
+	}
+
+	if body, err := ioutil.ReadAll(resp.HTTP.Body); err != nil || !bytes.Equal(body, resp.Body) {
+		t.Errorf("FAIL: unexpected HTTP body: '%s' != '%s' (%v)", body, resp.Body, err)
+	}
+
+	if resp := client.NewRequest("GET").SetHost("http://127.0.0.1:1").SetPath("/kv").Send(); resp.HTTP != nil {
+		t.Errorf("FAIL(unreachable): unexpected HTTP response: %v", resp.HTTP)
+	}
+}
+
+func TestClientEnableCookies(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/login", "POST", func(writer http.ResponseWriter) {
+			http.SetCookie(writer, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		}),
+		NewRoute("/whoami", "GET", func(httpReq *http.Request) string {
+			if cookie, err := httpReq.Cookie("session"); err == nil {
+				return cookie.Value
+			}
+			return "anonymous"
+		}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	whoami := func(client *Client) (session string) {
+		if err := client.NewRequest("GET").SetPath("/whoami").Send().GetBody(&session); err != nil {
+			t.Errorf("FAIL: unexpected error: %s", err)
+		}
+		return
+	}
+
+	client := &Client{Host: server.URL}
+	client.EnableCookies()
+	checkResp(t, "login", client.NewRequest("POST").SetPath("/login").Send())
+
+	if session := whoami(client); session != "s3cr3t" {
+		t.Errorf("FAIL(jar): unexpected session: '%s'", session)
+	}
+
+	if http.DefaultClient.Jar != nil {
+		t.Errorf("FAIL: jar installed on the default client")
+	}
+
+	other := &Client{Host: server.URL}
+	checkResp(t, "login-nojar", other.NewRequest("POST").SetPath("/login").Send())
+	if session := whoami(other); session != "anonymous" {
+		t.Errorf("FAIL(nojar): unexpected session: '%s'", session)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	check := func(value string, exp time.Duration, expOK bool) {
+		if delay, ok := parseRetryAfter(value, now); delay != exp || ok != expOK {
+			t.Errorf("FAIL(%s): unexpected delay: %s %v != %s %v", value, delay, ok, exp, expOK)
+		}
+	}
+
+	check("120", 2*time.Minute, true)
+	check("0", 0, true)
+	check("Wed, 21 Oct 2015 07:28:30 GMT", 30*time.Second, true)
+	check("Wed, 21 Oct 2015 07:27:00 GMT", 0, true)
+	check("", 0, false)
+	check("-1", 0, false)
+	check("soon", 0, false)
+}
+
+func TestRequestRetryAfter(t *testing.T) {
+	var count int
+	var retryAfter string
+	var code int
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		if count++; count == 1 {
+			writer.Header().Set("Retry-After", retryAfter)
+			writer.WriteHeader(code)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	send := func(respect bool) *Response {
+		count = 0
+		req := client.NewRequest("GET").SetRetry(1, 0).SetRespectRetryAfter(respect)
+		req.MaxRetryAfter = 50 * time.Millisecond
+		return req.Send()
+	}
+
+	code, retryAfter = http.StatusTooManyRequests, "120"
+	r0 := send(true)
+	checkResp(t, "seconds", r0)
+	if r0.Attempts != 2 || r0.Latency < 50*time.Millisecond || r0.Latency > time.Second {
+		t.Errorf("FAIL(seconds): unexpected retry: %d %s", r0.Attempts, r0.Latency)
+	}
+
+	code, retryAfter = http.StatusServiceUnavailable, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	r1 := send(true)
+	checkResp(t, "date", r1)
+	if r1.Attempts != 2 || r1.Latency < 50*time.Millisecond || r1.Latency > time.Second {
+		t.Errorf("FAIL(date): unexpected retry: %d %s", r1.Attempts, r1.Latency)
+	}
+
+	code, retryAfter = http.StatusServiceUnavailable, "120"
+	r2 := send(false)
+	checkResp(t, "ignored", r2)
+	if r2.Attempts != 2 || r2.Latency > 50*time.Millisecond {
+		t.Errorf("FAIL(ignored): unexpected retry: %d %s", r2.Attempts, r2.Latency)
+	}
+
+	code, retryAfter = http.StatusTooManyRequests, "0"
+	r3 := send(false)
+	failResp(t, "not-retryable", r3, EndpointError, http.StatusTooManyRequests)
+}
+
+func TestRequestFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		hop, _ := strconv.Atoi(strings.TrimPrefix(httpReq.URL.Path, "/"))
+		if hop < 3 {
+			http.Redirect(writer, httpReq, fmt.Sprintf("/%d", hop+1), http.StatusFound)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(strconv.Itoa(hop)))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var hop int
+	if err := client.NewRequest("GET").SetPath("/0").Send().GetBody(&hop); err != nil || hop != 3 {
+		t.Errorf("FAIL(default): unexpected result: %d %v", hop, err)
+	}
+
+	r0 := client.NewRequest("GET").SetPath("/0").SetFollowRedirects(0).Send()
+	failResp(t, "no-follow", r0, UnexpectedStatusCode, http.StatusFound)
+	if location := r0.Header.Get("Location"); location != "/1" {
+		t.Errorf("FAIL(no-follow): unexpected location: '%s'", location)
+	}
+
+	r1 := client.NewRequest("GET").SetPath("/0").SetFollowRedirects(2).Send()
+	failResp(t, "limit", r1, UnexpectedStatusCode, http.StatusFound)
+	if location := r1.Header.Get("Location"); location != "/3" {
+		t.Errorf("FAIL(limit): unexpected location: '%s'", location)
+	}
+
+	hop = 0
+	if err := client.NewRequest("GET").SetPath("/0").SetFollowRedirects(3).Send().GetBody(&hop); err != nil || hop != 3 {
+		t.Errorf("FAIL(within-limit): unexpected result: %d %v", hop, err)
+	}
+
+	if http.DefaultClient.CheckRedirect != nil {
+		t.Errorf("FAIL: redirect policy installed on the default client")
+	}
+}
+
+func TestRequestConditional(t *testing.T) {
+	modified := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.Header().Set("ETag", `"v1"`)
+		writer.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		writer.Header().Set("Content-Type", "application/json")
+
+		if httpReq.Header.Get("If-None-Match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if since, err := http.ParseTime(httpReq.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		writer.Write([]byte(`"body"`))
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var body string
+	r0 := client.NewRequest("GET").Send()
+	if err := r0.GetBody(&body); err != nil || body != "body" {
+		t.Errorf("FAIL(unconditional): unexpected result: '%s' %v", body, err)
+	}
+
+	body = "cached"
+	r1 := client.NewRequest("GET").SetIfNoneMatch(r0.Header.Get("ETag")).Send()
+	if err := r1.GetBody(&body); err == nil || err.Type != NotModified {
+		t.Errorf("FAIL(etag): unexpected error: %v", err)
+	} else if body != "cached" {
+		t.Errorf("FAIL(etag): body was unmarshalled: '%s'", body)
+	}
+
+	r2 := client.NewRequest("GET").SetIfModifiedSince(modified).Send()
+	failResp(t, "modified-since", r2, NotModified, http.StatusNotModified)
+
+	r3 := client.NewRequest("GET").SetIfNoneMatch(`"v0"`).Send()
+	checkResp(t, "stale-etag", r3)
+}
+
+func TestRequestSignFunc(t *testing.T) {
+	key := []byte("secret")
+
+	sign := func(method, path string, body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(method + "\n" + path + "\n"))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		body, _ := ioutil.ReadAll(httpReq.Body)
+		if httpReq.Header.Get("X-Signature") != sign(httpReq.Method, httpReq.URL.RequestURI(), body) {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		signatures = append(signatures, httpReq.Header.Get("X-Signature"))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		Host: server.URL,
+		SignFunc: func(req *Request) (string, string) {
+			return "X-Signature", sign(req.HTTP.Method, req.HTTP.URL.RequestURI(), req.Body)
+		},
+	}
+
+	checkResp(t, "body", client.NewRequest("PUT").SetPath("/kv/a").AddParam("v", "1").SetBody(&KV{"a", "1"}).Send())
+	checkResp(t, "empty", client.NewRequest("DELETE").SetPath("/kv/a").Send())
+
+	exp := sign("PUT", "/kv/a?v=1", []byte(`{"key":"a","val":"1"}`))
+	if len(signatures) != 2 || signatures[0] != exp {
+		t.Errorf("FAIL: unexpected signatures: %v != %s", signatures, exp)
+	}
+
+	unsigned := client.NewRequest("DELETE").SetPath("/kv/a").SetSignFunc(nil).Send()
+	failResp(t, "unsigned", unsigned, EndpointError, http.StatusUnauthorized)
+}
+
+func TestRequestContentLength(t *testing.T) {
+	var lengths []string
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		body, _ := ioutil.ReadAll(httpReq.Body)
+		lengths = append(lengths, strings.Join(httpReq.Header["Content-Length"], ","))
+		bodies = append(bodies, string(body))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	kv := &KV{"clé", "日本語"}
+	exp, _ := json.Marshal(kv)
+
+	r0 := client.NewRequest("PUT").SetBody(&KV{"a", "1"}).SetBody(kv)
+	checkResp(t, "utf8", r0.Send())
+
+	r1 := client.NewRequest("PUT").AddHeader("Content-Length", "3").SetBodyRaw([]byte("héllo"), "text/plain")
+	checkResp(t, "manual", r1.Send())
+
+	if len(lengths) != 2 || lengths[0] != strconv.Itoa(len(exp)) || lengths[1] != "6" {
+		t.Errorf("FAIL: unexpected lengths: %v", lengths)
+	}
+
+	if len(bodies) != 2 || bodies[0] != string(exp) || bodies[1] != "héllo" {
+		t.Errorf("FAIL: unexpected bodies: %q", bodies)
+	}
+
+	if _, ok := r0.Header["Content-Length"]; ok {
+		t.Errorf("FAIL: Content-Length set on the request: %v", r0.Header)
+	}
+}
+
+func TestRequestSetFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		if err := httpReq.ParseForm(); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(httpReq.PostForm)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	values := url.Values{"name": {"Zoë & co"}, "tag": {"a", "b=c"}}
+
+	var form url.Values
+	if err := client.NewRequest("POST").SetFormBody(values).Send().GetBody(&form); err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	} else if !reflect.DeepEqual(form, values) {
+		t.Errorf("FAIL: unexpected form: %v != %v", form, values)
+	}
+}
+
+func TestRequestSetMultipart(t *testing.T) {
+	var lengths []int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		lengths = append(lengths, httpReq.ContentLength)
+
+		if err := httpReq.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := make(map[string]string)
+		for name, values := range httpReq.MultipartForm.Value {
+			result[name] = values[0]
+		}
+
+		for name, headers := range httpReq.MultipartForm.File {
+			file, _ := headers[0].Open()
+			data, _ := ioutil.ReadAll(file)
+			file.Close()
+			result[name] = headers[0].Filename + ":" + string(data)
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(result)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	fields := map[string]string{"title": "report", "author": "Zoë"}
+	exp := map[string]string{"title": "report", "author": "Zoë", "data.csv": "data.csv:a,b\n1,2\n"}
+
+	send := func(title string, file io.Reader) {
+		var result map[string]string
+		req := client.NewRequest("POST").SetMultipart(fields, map[string]io.Reader{"data.csv": file})
+		if err := req.Send().GetBody(&result); err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", title, err)
+		} else if !reflect.DeepEqual(result, exp) {
+			t.Errorf("FAIL(%s): unexpected form: %v != %v", title, result, exp)
+		}
+	}
+
+	send("sized", strings.NewReader("a,b\n1,2\n"))
+	send("streamed", ioutil.NopCloser(strings.NewReader("a,b\n1,2\n")))
+
+	if len(lengths) != 2 || lengths[0] <= 0 || lengths[1] != -1 {
+		t.Errorf("FAIL: unexpected content lengths: %v", lengths)
+	}
+}
+
+func TestRequestNoBodyContentType(t *testing.T) {
+	var contentTypes []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		contentTypes = append(contentTypes, strings.Join(httpReq.Header["Content-Type"], ","))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	checkResp(t, "get", client.NewRequest("GET").Send())
+	checkResp(t, "delete", client.NewRequest("DELETE").SetCodec(JSONCodec).Send())
+	checkResp(t, "put", client.NewRequest("PUT").SetBody(&KV{"a", "1"}).Send())
+
+	exp := []string{"", "", "application/json"}
+	if !reflect.DeepEqual(contentTypes, exp) {
+		t.Errorf("FAIL: unexpected content types: %q != %q", contentTypes, exp)
+	}
+}
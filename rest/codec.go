@@ -0,0 +1,158 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec serializes the bodies of requests and responses for a media type.
+type Codec interface {
+
+	// ContentType returns the media type handled by the codec which is used
+	// as the Content-Type header of the encoded bodies.
+	ContentType() string
+
+	// Marshal encodes the given object.
+	Marshal(obj interface{}) ([]byte, error)
+
+	// Unmarshal decodes the given body into the object pointed to by obj.
+	Unmarshal(body []byte, obj interface{}) error
+}
+
+// StreamDecoder can be implemented by a Codec to decode bodies as they're read
+// instead of first buffering them in memory.
+type StreamDecoder interface {
+	Decode(reader io.Reader, obj interface{}) error
+}
+
+// unmarshalBody decodes the body read from the given reader, which can be nil
+// for empty bodies, using the given codec.
+func unmarshalBody(codec Codec, reader io.Reader, obj interface{}) error {
+	if reader == nil {
+		return codec.Unmarshal(nil, obj)
+	}
+
+	if decoder, ok := codec.(StreamDecoder); ok {
+		return decoder.Decode(reader, obj)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(body, obj)
+}
+
+// JSONCodec is the default codec which encodes bodies as application/json.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct {
+	marshal func(interface{}) ([]byte, error)
+}
+
+func (codec jsonCodec) ContentType() string { return "application/json" }
+
+func (codec jsonCodec) Marshal(obj interface{}) ([]byte, error) {
+	if codec.marshal == nil {
+		return json.Marshal(obj)
+	}
+	return codec.marshal(obj)
+}
+
+func (codec jsonCodec) Unmarshal(body []byte, obj interface{}) error {
+	return json.Unmarshal(body, obj)
+}
+
+// Decode rejects trailing data after the decoded value like json.Unmarshal.
+func (codec jsonCodec) Decode(reader io.Reader, obj interface{}) error {
+	decoder := json.NewDecoder(reader)
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// requestCodec returns the codec registered for the media type of the given
+// Content-Type header value.
+func (mux *Mux) requestCodec(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	codec, ok := mux.codecs[mediaType]
+	return codec, ok
+}
+
+// responseCodec returns the codec preferred by the given Accept header value.
+// Falls back to the given codec, usually the one of the request body, if the
+// header is missing or doesn't name any registered media type.
+func (mux *Mux) responseCodec(accept string, fallback Codec) Codec {
+	type acceptItem struct {
+		mediaType string
+		weight    float64
+	}
+
+	var items []acceptItem
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+
+		items = append(items, acceptItem{mediaType, weight})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].weight > items[j].weight })
+
+	for _, item := range items {
+		if codec, ok := mux.codecs[item.mediaType]; ok {
+			return codec
+		}
+
+		if item.mediaType == "*/*" || !strings.HasSuffix(item.mediaType, "/*") {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(item.mediaType, "*")
+		if strings.HasPrefix(fallback.ContentType(), prefix) {
+			return fallback
+		}
+		for _, mediaType := range mux.mediaTypes() {
+			if strings.HasPrefix(mediaType, prefix) {
+				return mux.codecs[mediaType]
+			}
+		}
+	}
+
+	return fallback
+}
+
+// mediaTypes returns the sorted list of media types with a registered codec.
+func (mux *Mux) mediaTypes() []string {
+	var mediaTypes []string
+	for mediaType := range mux.codecs {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	return mediaTypes
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string                     { return "application/xml" }
+func (xmlCodec) Marshal(obj interface{}) ([]byte, error) { return xml.Marshal(obj) }
+func (xmlCodec) Unmarshal(body []byte, obj interface{}) error {
+	return xml.Unmarshal(body, obj)
+}
+
+func TestMuxCodecs(t *testing.T) {
+	mux := &Mux{Codecs: map[string]Codec{"application/xml": xmlCodec{}}}
+	mux.AddRoute(NewRoute("/echo", "POST", func(kv KV) *KV { return &kv }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	xmlBody := "<KV><Key>a</Key><Val>1</Val></KV>"
+	jsonBody := `{"key":"a","val":"1"}`
+
+	send := func(title, contentType, accept, body string, expType, expBody string) {
+		httpReq, _ := http.NewRequest("POST", server.URL+"/echo", bytes.NewBufferString(body))
+		httpReq.Header.Set("Content-Type", contentType)
+		if len(accept) > 0 {
+			httpReq.Header.Set("Accept", accept)
+		}
+
+		httpResp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", title, err)
+			return
+		}
+		defer httpResp.Body.Close()
+
+		respBody, _ := ioutil.ReadAll(httpResp.Body)
+		if httpResp.StatusCode != http.StatusOK {
+			t.Errorf("FAIL(%s): unexpected status code: %d '%s'", title, httpResp.StatusCode, respBody)
+			return
+		}
+
+		if contentType := httpResp.Header.Get("Content-Type"); contentType != expType {
+			t.Errorf("FAIL(%s): unexpected content type: %s != %s", title, contentType, expType)
+		}
+
+		if string(respBody) != expBody {
+			t.Errorf("FAIL(%s): unexpected body: %s != %s", title, respBody, expBody)
+		}
+	}
+
+	send("json", "application/json", "", jsonBody, "application/json", jsonBody)
+	send("xml", "application/xml; charset=utf-8", "", xmlBody, "application/xml", xmlBody)
+	send("json-accept-xml", "application/json", "application/xml", jsonBody, "application/xml", xmlBody)
+	send("xml-accept-json", "application/xml", "text/html, application/json", xmlBody, "application/json", jsonBody)
+	send("accept-q", "application/json", "application/json;q=0.5, application/xml", jsonBody, "application/xml", xmlBody)
+	send("accept-wildcard", "application/xml", "*/*", xmlBody, "application/xml", xmlBody)
+	send("accept-subtype", "application/json", "text/*, application/*", jsonBody, "application/json", jsonBody)
+	send("accept-unknown", "application/xml", "text/plain", xmlBody, "application/xml", xmlBody)
+
+	httpResp, err := http.Post(server.URL+"/echo", "text/plain", bytes.NewBufferString(jsonBody))
+	if err != nil {
+		t.Errorf("FAIL(unsupported): unexpected error: %s", err)
+	} else {
+		httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusBadRequest {
+			t.Errorf("FAIL(unsupported): unexpected status code: %d", httpResp.StatusCode)
+		}
+	}
+}
+
+func TestRequestCodec(t *testing.T) {
+	mux := &Mux{Codecs: map[string]Codec{"application/xml": xmlCodec{}}}
+	mux.AddRoute(
+		NewRoute("/echo", "POST", func(kv KV) *KV { return &kv }),
+		NewRoute("/get", "GET", func() *KV { return &KV{"b", "2"} }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	req := client.NewRequest("POST").SetPath("/echo").SetCodec(xmlCodec{}).SetBody(&KV{"a", "1"})
+	if string(req.Body) != "<KV><Key>a</Key><Val>1</Val></KV>" {
+		t.Errorf("FAIL(body): unexpected body: %s", req.Body)
+	}
+
+	resp := req.Send()
+	checkRespBody(t, "echo", resp, &KV{"a", "1"})
+	if contentType := req.HTTP.Header.Get("Content-Type"); contentType != "application/xml" {
+		t.Errorf("FAIL(echo): unexpected request content type: %s", contentType)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/xml" {
+		t.Errorf("FAIL(echo): unexpected content type: %s", contentType)
+	}
+
+	resp = client.NewRequest("GET").SetPath("/get").SetCodec(xmlCodec{}).Send()
+	checkRespBody(t, "get", resp, &KV{"b", "2"})
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/xml" {
+		t.Errorf("FAIL(get): unexpected content type: %s", contentType)
+	}
+
+	checkRespBody(t, "json", client.NewRequest("GET").SetPath("/get").Send(), &KV{"b", "2"})
+
+	resp = client.NewRequest("GET").SetPath("/get").AddHeader("Accept", "application/xml").Send()
+	var kv KV
+	if err := resp.GetBody(&kv); err == nil || err.Type != UnsupportedContentType {
+		t.Errorf("FAIL(unsupported): expected UnsupportedContentType error: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig controls the Cross-Origin Resource Sharing headers emitted by a
+// Mux. Requests without an Origin header or whose origin is not allowed are
+// served without any CORS headers.
+type CORSConfig struct {
+
+	// AllowedOrigins is the list of origins allowed to make cross-origin
+	// requests. The special value "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowedMethods is the list of methods returned in response to preflight
+	// requests. Defaults to the methods registered for the requested path.
+	AllowedMethods []string
+
+	// AllowedHeaders is the list of headers returned in response to preflight
+	// requests. Defaults to the headers requested by the preflight request.
+	AllowedHeaders []string
+
+	// AllowCredentials indicates whether the response can be exposed when the
+	// request includes credentials like cookies. Since browsers reject the "*"
+	// origin for such requests, the origin of the request is echoed instead.
+	AllowCredentials bool
+
+	// MaxAge is how long the results of a preflight request can be cached.
+	// Zero leaves the caching duration to the browser.
+	MaxAge time.Duration
+}
+
+func (config *CORSConfig) allowsOrigin(origin string) (wildcard, ok bool) {
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			wildcard, ok = true, true
+		} else if allowed == origin {
+			return false, true
+		}
+	}
+	return
+}
+
+// cors adds the CORS headers to the response and returns true if the request
+// was a preflight request that was fully answered.
+func (mux *Mux) cors(writer http.ResponseWriter, httpReq *http.Request) bool {
+	origin := httpReq.Header.Get("Origin")
+	if len(origin) == 0 {
+		return false
+	}
+
+	header := writer.Header()
+	header.Add("Vary", "Origin")
+
+	wildcard, ok := mux.CORS.allowsOrigin(origin)
+	if !ok {
+		return false
+	}
+
+	if wildcard && !mux.CORS.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if mux.CORS.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if httpReq.Method != "OPTIONS" || len(httpReq.Header.Get("Access-Control-Request-Method")) == 0 {
+		return false
+	}
+
+	methods := mux.CORS.AllowedMethods
+	if len(methods) == 0 {
+		methods = mux.methods(httpReq.URL.Path)
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(mux.CORS.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(mux.CORS.AllowedHeaders, ", "))
+	} else if headers := httpReq.Header.Get("Access-Control-Request-Headers"); len(headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if mux.CORS.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(mux.CORS.MaxAge/time.Second)))
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+	return true
+}
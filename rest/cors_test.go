@@ -0,0 +1,93 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func checkCORS(t *testing.T, title string, mux *Mux, httpReq *http.Request, code int, exp map[string]string) {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if recorder.Code != code {
+		t.Errorf("FAIL(%s): unexpected status code: %d != %d", title, recorder.Code, code)
+	}
+
+	for key, value := range exp {
+		if header := recorder.Header().Get(key); header != value {
+			t.Errorf("FAIL(%s): unexpected header '%s': '%s' != '%s'", title, key, header, value)
+		}
+	}
+}
+
+func newCORSRequest(method, origin string) *http.Request {
+	httpReq := httptest.NewRequest(method, "/x", nil)
+	httpReq.Header.Set("Origin", origin)
+	return httpReq
+}
+
+func TestMuxCORS(t *testing.T) {
+	mux := &Mux{CORS: &CORSConfig{
+		AllowedOrigins: []string{"http://a.com"},
+		MaxAge:         time.Hour,
+	}}
+	mux.AddRoute(
+		NewRoute("/x", "GET", func() string { return "x" }),
+		NewRoute("/x", "PUT", func() {}))
+
+	preflight := newCORSRequest("OPTIONS", "http://a.com")
+	preflight.Header.Set("Access-Control-Request-Method", "PUT")
+	preflight.Header.Set("Access-Control-Request-Headers", "X-Custom")
+
+	checkCORS(t, "preflight", mux, preflight, http.StatusNoContent, map[string]string{
+		"Access-Control-Allow-Origin":  "http://a.com",
+		"Access-Control-Allow-Methods": "GET, HEAD, PUT",
+		"Access-Control-Allow-Headers": "X-Custom",
+		"Access-Control-Max-Age":       "3600",
+	})
+
+	checkCORS(t, "actual", mux, newCORSRequest("GET", "http://a.com"), http.StatusOK, map[string]string{
+		"Access-Control-Allow-Origin":  "http://a.com",
+		"Access-Control-Allow-Methods": "",
+		"Vary":                         "Origin",
+	})
+
+	checkCORS(t, "disallowed", mux, newCORSRequest("GET", "http://b.com"), http.StatusOK, map[string]string{
+		"Access-Control-Allow-Origin": "",
+	})
+
+	checkCORS(t, "no-origin", mux, httptest.NewRequest("GET", "/x", nil), http.StatusOK, map[string]string{
+		"Access-Control-Allow-Origin": "",
+		"Vary":                        "",
+	})
+}
+
+func TestMuxCORSWildcard(t *testing.T) {
+	mux := &Mux{CORS: &CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization"},
+	}}
+	mux.AddRoute(NewRoute("/x", "GET", func() string { return "x" }))
+
+	preflight := newCORSRequest("OPTIONS", "http://b.com")
+	preflight.Header.Set("Access-Control-Request-Method", "POST")
+
+	checkCORS(t, "preflight", mux, preflight, http.StatusNoContent, map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization",
+		"Access-Control-Max-Age":       "",
+	})
+
+	mux.CORS.AllowCredentials = true
+
+	checkCORS(t, "credentials", mux, newCORSRequest("GET", "http://b.com"), http.StatusOK, map[string]string{
+		"Access-Control-Allow-Origin":      "http://b.com",
+		"Access-Control-Allow-Credentials": "true",
+	})
+}
@@ -12,8 +12,10 @@ a matching path.
 Paths can contain variable components denoted by a leading ':' character. These
 variable arguments will be used to automatically populate the arguments of the
 handler. Constant components take precedence over variable components during
-routing. Note that a request can only be routed to a single handler and
-duplicate paths are therefore rejected.
+routing unless the Priority of the route with the variable component is higher.
+Note that a request can only be routed to a single handler and
+duplicate paths are therefore rejected. Handlers can also declare leading
+*http.Request or context.Context arguments to access the incoming HTTP request.
 
 Clients are provided by the Client struct which allows the incremental
 construction of REST request. The response is sent when calling the
@@ -0,0 +1,69 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DOT returns a Graphviz DOT representation of the routes registered with the
+// mux. Each path prefix is rendered as a node linked to its parent prefix and
+// nodes which terminate a route are labelled with their HTTP methods.
+func (mux *Mux) DOT() string {
+	mux.Init()
+
+	methods := make(map[string][]string)
+	edges := make(map[string]string)
+
+	for _, route := range mux.router.Routes() {
+		key := route.Path.String()
+		methods[key] = append(methods[key], route.Method)
+
+		for i := 0; i <= len(route.Path); i++ {
+			node := route.Path[:i].String()
+			if _, ok := edges[node]; ok || i == 0 {
+				continue
+			}
+			edges[node] = route.Path[:i-1].String()
+		}
+	}
+
+	var nodes []string
+	nodes = append(nodes, "/")
+	for node := range edges {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes[1:])
+
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("digraph routes {\n")
+	buffer.WriteString("\trankdir=LR;\n")
+	buffer.WriteString("\tnode [shape=box];\n")
+
+	for _, node := range nodes {
+		label := dotEscaper.Replace(node)
+		if list, ok := methods[node]; ok {
+			sort.Strings(list)
+			label += "\\n" + strings.Join(list, " ")
+		}
+		fmt.Fprintf(buffer, "\t%s [label=\"%s\"];\n", dotQuote(node), label)
+	}
+
+	for _, node := range nodes[1:] {
+		fmt.Fprintf(buffer, "\t%s -> %s;\n", dotQuote(edges[node]), dotQuote(node))
+	}
+
+	buffer.WriteString("}\n")
+	return buffer.String()
+}
+
+// dotEscaper escapes the backslashes and quotes of strings embedded in quoted
+// DOT strings.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func dotQuote(str string) string {
+	return "\"" + dotEscaper.Replace(str) + "\""
+}
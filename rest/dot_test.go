@@ -0,0 +1,48 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMuxDOT(t *testing.T) {
+	mux := new(Mux)
+	mux.AddService(&TestService{})
+
+	dot := mux.DOT()
+
+	if !strings.HasPrefix(dot, "digraph routes {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("FAIL: malformed graph:\n%s", dot)
+	}
+
+	exp := []string{
+		`"/" [label="/"];`,
+		`"/map/" [label="/map/\nPOST"];`,
+		`"/map/:key/" [label="/map/:key/\nDELETE GET PUT"];`,
+		`"/map/gzip/:key/" [label="/map/gzip/:key/\nGET"];`,
+		`"/" -> "/map/";`,
+		`"/map/" -> "/map/:key/";`,
+		`"/map/" -> "/map/gzip/";`,
+		`"/map/gzip/" -> "/map/gzip/:key/";`,
+	}
+
+	for _, line := range exp {
+		if !strings.Contains(dot, line) {
+			t.Errorf("FAIL: missing '%s' in graph:\n%s", line, dot)
+		}
+	}
+}
+
+func TestMuxDOTEscape(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute(`/a\b"c`, "GET", func() {}))
+
+	dot := mux.DOT()
+
+	exp := `"/a\\b\"c/" [label="/a\\b\"c/\nGET"];`
+	if !strings.Contains(dot, exp) {
+		t.Errorf("FAIL: missing '%s' in graph:\n%s", exp, dot)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// PreCompressed can be returned by a route handler to send a JSON body that
+// was already serialized and compressed, typically from a cache. The body is
+// written as is along with the matching Content-Encoding header if the client
+// accepts the encoding. Otherwise the body is decompressed before being sent
+// which is only supported for the gzip and deflate encodings.
+type PreCompressed struct {
+
+	// Encoding is the content encoding of the body (e.g. gzip).
+	Encoding string
+
+	// Body is the compressed JSON body.
+	Body []byte
+}
+
+// isMultipartContentType returns true if the media type of the given
+// Content-Type header value is multipart/form-data.
+func isMultipartContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// acceptsEncoding returns true if the given Accept-Encoding header value allows
+// the given content encoding. An explicit entry for the encoding takes
+// precedence over the * wildcard.
+func acceptsEncoding(header, encoding string) bool {
+	wildcard := false
+
+	for _, item := range strings.Split(header, ",") {
+		name, q := item, ""
+		if i := strings.Index(item, ";"); i >= 0 {
+			name, q = item[:i], strings.TrimSpace(item[i+1:])
+		}
+
+		accepted := true
+		if strings.HasPrefix(q, "q=") {
+			weight, err := strconv.ParseFloat(q[2:], 64)
+			accepted = err == nil && weight > 0
+		}
+
+		if name = strings.TrimSpace(name); strings.EqualFold(name, encoding) {
+			return accepted
+		} else if name == "*" {
+			wildcard = accepted
+		}
+	}
+
+	return wildcard
+}
+
+// decodeBody decompresses the given body according to its content encoding.
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: '%s'", encoding)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// decodeBodyEncodings decompresses the given body according to the given list
+// of content encodings which are undone in the reverse order of their
+// application. The identity encoding is ignored.
+func decodeBodyEncodings(encodings []string, body []byte) ([]byte, error) {
+	var list []string
+	for _, value := range encodings {
+		list = append(list, strings.Split(value, ",")...)
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		encoding := strings.TrimSpace(list[i])
+		if len(encoding) == 0 || strings.EqualFold(encoding, "identity") {
+			continue
+		}
+
+		var err error
+		if body, err = decodeBody(encoding, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
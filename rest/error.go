@@ -3,57 +3,110 @@
 package rest
 
 import (
+	"encoding/json"
 	"fmt"
 )
 
 // ErrorType is used to categories errors reported into types.
 type ErrorType string
 
+// String returns the stable name of the error type which is suitable for logs
+// and error bodies.
+func (errType ErrorType) String() string {
+	return string(errType)
+}
+
+// Error returns the name of the error type which allows error types to be used
+// as targets of errors.Is to check the type of an Error.
+func (errType ErrorType) Error() string {
+	return errType.String()
+}
+
+// MarshalJSON serializes the error type as its name.
+func (errType ErrorType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(errType.String())
+}
+
 const (
 	// EndpointError indicates that the remote endpoint returned an error.
-	EndpointError = "endpoint-error"
+	EndpointError ErrorType = "endpoint-error"
 
 	// HandlerError indicates that the route handler returned an error.
-	HandlerError = "handler-error"
+	HandlerError ErrorType = "handler-error"
+
+	// PanicError indicates that the route handler panicked.
+	PanicError ErrorType = "panic-error"
 
 	// UnknownRoute indicates that no matching routes were found for the path.
-	UnknownRoute = "unknown-route"
+	UnknownRoute ErrorType = "unknown-route"
+
+	// UnknownMethod indicates that routes were found for the path but none of
+	// them matched the method.
+	UnknownMethod ErrorType = "unknown-method"
+
+	// PathTooLong indicates that the path of an HTTP request exceeded the
+	// configured limit.
+	PathTooLong ErrorType = "path-too-long"
+
+	// BodyTooLarge indicates that the body of an HTTP request exceeded the
+	// configured limit.
+	BodyTooLarge ErrorType = "body-too-large"
+
+	// TooManyRequests indicates that an HTTP request was rejected by a
+	// RateLimiter.
+	TooManyRequests ErrorType = "too-many-requests"
 
 	// UnexpectedStatusCode indicates that the returned status code of an HTTP
 	// request was not expected.
-	UnexpectedStatusCode = "unexpected-status-code"
+	UnexpectedStatusCode ErrorType = "unexpected-status-code"
+
+	// NotModified indicates that the endpoint returned a 304 response to a
+	// conditional request and that the cached copy of the body is still valid.
+	NotModified ErrorType = "not-modified"
 
 	// UnsupportedContentType indicates that the content-type header of an HTTP
 	// request contained an unsupported value.
-	UnsupportedContentType = "unsupported-content-type"
+	UnsupportedContentType ErrorType = "unsupported-content-type"
 
 	// ReadBodyError indicates that an error occured while reading the body of
 	// an HTTP request or response.
-	ReadBodyError = "ready-body-error"
+	ReadBodyError ErrorType = "ready-body-error"
+
+	// InvalidRequestError indicates that a REST request was misconfigured and
+	// couldn't be sent.
+	InvalidRequestError ErrorType = "invalid-request-error"
 
 	// NewRequestError indicates that an error occured while creating an HTTP
 	// request.
-	NewRequestError = "new-request-error"
+	NewRequestError ErrorType = "new-request-error"
 
 	// SendRequestError indicates that an error occured while sending an HTTP
 	// request.
-	SendRequestError = "send-request-error"
+	SendRequestError ErrorType = "send-request-error"
 
 	// TimeoutError indicates that the request timed out while sending an HTTP
 	// request.
-	TimeoutError = "timeout-error"
+	TimeoutError ErrorType = "timeout-error"
+
+	// ContextError indicates that the context of a request was cancelled or
+	// that its deadline expired while sending an HTTP request.
+	ContextError ErrorType = "context-error"
 
 	// UnmarshalError indicates that an error occured while deserializing the
 	// body of an HTTP response.
-	UnmarshalError = "unmarshal-error"
+	UnmarshalError ErrorType = "unmarshal-error"
 
 	// GzipError indicates that an error occured while compressing the
 	// body of an HTTP response into gzip.
-	GzipError = "gzip-error"
+	GzipError ErrorType = "gzip-error"
+
+	// ContentEncodingError indicates that an error occured while decoding the
+	// content encoding of a body.
+	ContentEncodingError ErrorType = "content-encoding-error"
 
 	// MarshalError indicates that an error occured while serializing the body
 	// of an HTTP request.
-	MarshalError = "marshal-error"
+	MarshalError ErrorType = "marshal-error"
 )
 
 // Error is a typed wrapper for an error that occured while processing a REST
@@ -79,6 +132,31 @@ func (err *Error) Error() string {
 	return fmt.Sprintf("REST error(%s): %s", err.Type, err.Sub.Error())
 }
 
+// Unwrap returns the wrapped error.
+func (err *Error) Unwrap() error {
+	if err == nil {
+		return nil
+	}
+	return err.Sub
+}
+
+// Is returns true if the target is an ErrorType or an Error with the same type
+// as the error. This allows errors.Is(err, UnmarshalError) to check the type of
+// the error.
+func (err *Error) Is(target error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch target := target.(type) {
+	case ErrorType:
+		return err.Type == target
+	case *Error:
+		return target != nil && err.Type == target.Type
+	}
+	return false
+}
+
 // CodedError is used to control the HTTP return code of a REST request when an
 // error occurs.
 //
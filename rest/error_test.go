@@ -0,0 +1,98 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorTypeString(t *testing.T) {
+	types := []ErrorType{
+		EndpointError,
+		HandlerError,
+		PanicError,
+		UnknownRoute,
+		UnknownMethod,
+		PathTooLong,
+		BodyTooLarge,
+		TooManyRequests,
+		UnexpectedStatusCode,
+		NotModified,
+		UnsupportedContentType,
+		ReadBodyError,
+		InvalidRequestError,
+		NewRequestError,
+		SendRequestError,
+		TimeoutError,
+		ContextError,
+		UnmarshalError,
+		GzipError,
+		ContentEncodingError,
+		MarshalError,
+	}
+
+	names := make(map[string]bool)
+	for _, errType := range types {
+		name := errType.String()
+		if len(name) == 0 {
+			t.Errorf("FAIL: empty name for error type")
+		} else if names[name] {
+			t.Errorf("FAIL: duplicate name '%s'", name)
+		}
+		names[name] = true
+
+		js, err := json.Marshal(errType)
+		if err != nil {
+			t.Errorf("FAIL(%s): unexpected marshal error: %s", name, err)
+		} else if string(js) != `"`+name+`"` {
+			t.Errorf("FAIL(%s): unexpected json: %s", name, js)
+		}
+	}
+}
+
+type causeError struct{ msg string }
+
+func (err *causeError) Error() string { return err.msg }
+
+func TestErrorUnwrap(t *testing.T) {
+	cause := &causeError{"boom"}
+	err := &Error{UnmarshalError, fmt.Errorf("wrapped: %w", cause)}
+
+	if !errors.Is(err, UnmarshalError) {
+		t.Errorf("FAIL: expected error to match its type")
+	}
+	if errors.Is(err, HandlerError) {
+		t.Errorf("FAIL: unexpected match on another type")
+	}
+	if !errors.Is(err, &Error{Type: UnmarshalError}) {
+		t.Errorf("FAIL: expected error to match an error of the same type")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("FAIL: expected error to match its cause")
+	}
+
+	var target *causeError
+	if !errors.As(err, &target) || target != cause {
+		t.Errorf("FAIL: expected error to unwrap to its cause: %v", target)
+	}
+
+	var restErr *Error
+	if !errors.As(fmt.Errorf("outer: %w", err), &restErr) || restErr.Type != UnmarshalError {
+		t.Errorf("FAIL: expected wrapped error to unwrap to the rest error: %v", restErr)
+	}
+
+	var resp Response
+	if errors.Is(resp.GetBody(nil), UnmarshalError) {
+		t.Errorf("FAIL: unexpected match on nil error")
+	}
+
+	resp = Response{Code: http.StatusOK, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte("{")}
+	var kv KV
+	if err := resp.GetBody(&kv); !errors.Is(err, UnmarshalError) {
+		t.Errorf("FAIL: expected unmarshal error: %v", err)
+	}
+}
@@ -130,3 +130,27 @@ func ExamplePing() {
 	// ping-simple: 123
 	// ping-client: 321
 }
+
+func ExampleMux_ServeTest() {
+	mux := new(rest.Mux)
+	mux.AddService(&PingService{})
+
+	// The body is marshalled to JSON and the request is served directly by the
+	// mux without going through a server.
+	recorder, err := mux.ServeTest("POST", "/ping", 123)
+	if err != nil {
+		panic("Whoops!")
+	}
+	fmt.Println("ping:", recorder.Code, recorder.Body.String())
+
+	recorder, _ = mux.ServeTest("PUT", "/ping/321", nil)
+	fmt.Println("ping-path:", recorder.Code, recorder.Body.String())
+
+	recorder, _ = mux.ServeTest("POST", "/ping/error", nil)
+	fmt.Print("ping-error: ", recorder.Code, " ", recorder.Body.String())
+
+	// Output:
+	// ping: 200 123
+	// ping-path: 200 321
+	// ping-error: 400 BOOM
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import "net/http"
+
+// Group registers routes on a Mux under a common path prefix and wraps them in
+// a common set of middlewares. Groups are created via Mux.Group.
+type Group struct {
+	mux        *Mux
+	prefix     Path
+	middleware []func(http.Handler) http.Handler
+}
+
+// Group returns a Group whose routes are registered on the mux under the given
+// path prefix.
+func (mux *Mux) Group(prefix string) *Group {
+	return &Group{mux: mux, prefix: NewPath(prefix)}
+}
+
+// Group returns a nested group whose prefix is appended to the prefix of the
+// group and which inherits the middlewares of the group added so far.
+func (group *Group) Group(prefix string) *Group {
+	return &Group{
+		mux:        group.mux,
+		prefix:     append(append(Path{}, group.prefix...), NewPath(prefix)...),
+		middleware: append([]func(http.Handler) http.Handler(nil), group.middleware...),
+	}
+}
+
+// Use adds a middleware which wraps the processing of the requests routed to
+// the routes of the group. Group middlewares are applied in the order they were
+// added and run within the middlewares registered via Mux.Use and around the
+// Middleware of each route. Only applies to the routes added afterwards.
+func (group *Group) Use(middleware func(http.Handler) http.Handler) {
+	group.middleware = append(group.middleware, middleware)
+}
+
+// AddRoute adds copies of the given routes to the mux with the prefix of the
+// group prepended to their path.
+func (group *Group) AddRoute(routes ...*Route) {
+	for _, route := range routes {
+		clone := route.withPath(append(append(Path{}, group.prefix...), route.Path...))
+
+		if len(group.middleware) > 0 {
+			clone.Middleware = append(
+				append([]func(http.Handler) http.Handler(nil), group.middleware...),
+				route.Middleware...)
+		}
+
+		group.mux.AddRoute(clone)
+	}
+}
+
+// AddService adds all the routes returned by the Routable objects to the group.
+func (group *Group) AddService(routables ...Routable) {
+	for _, routable := range routables {
+		group.AddRoute(routable.RESTRoutes()...)
+	}
+}
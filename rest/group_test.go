@@ -0,0 +1,73 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMuxGroup(t *testing.T) {
+	var order []string
+
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(writer, httpReq)
+			})
+		}
+	}
+
+	mux := new(Mux)
+	mux.Use(trace("global"))
+
+	api := mux.Group("/api/v1")
+	api.Use(trace("api"))
+	api.AddRoute(
+		NewRoute("/users/:id", "GET", func(id string) string { return "user-" + id }),
+		&Route{
+			Path:       NewPath("/admin"),
+			Method:     "GET",
+			Handler:    func() string { return "admin" },
+			Middleware: []func(http.Handler) http.Handler{trace("route")},
+		})
+
+	internal := api.Group("/internal")
+	internal.Use(trace("internal"))
+	internal.AddService(&TestService{})
+
+	mux.AddRoute(NewRoute("/users/:id", "GET", func(id string) string { return "root-" + id }))
+
+	check := func(path string, code int, exp ...string) {
+		order = nil
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", path, recorder.Code, code)
+		}
+		if strings.Join(order, ",") != strings.Join(exp, ",") {
+			t.Errorf("FAIL(%s): unexpected middlewares: %v != %v", path, order, exp)
+		}
+	}
+
+	check("/api/v1/users/1", http.StatusOK, "global", "api")
+	check("/api/v1/admin", http.StatusOK, "global", "api", "route")
+	check("/api/v1/internal/map/a", http.StatusBadRequest, "global", "api", "internal")
+	check("/users/1", http.StatusOK, "global")
+	check("/api/v1/map/a", http.StatusNotFound, "global")
+
+	paths := make(map[string]bool)
+	for _, route := range mux.Routes() {
+		paths[route.Path.String()] = true
+	}
+	for _, path := range []string{"/api/v1/users/:id/", "/api/v1/admin/", "/api/v1/internal/map/:key/", "/users/:id/"} {
+		if !paths[path] {
+			t.Errorf("FAIL: missing route '%s' in %v", path, paths)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+// InProcessHost is the host used by clients created via NewInProcessClient.
+const InProcessHost = "http://in-process"
+
+// NewInProcessClient creates a client whose requests are dispatched directly to
+// the ServeHTTP function of the given mux instead of going over the network.
+// Requests still go through a regular http.Client so the semantics of the
+// requests and responses are the same as with a remote endpoint.
+func NewInProcessClient(mux *Mux) *Client {
+	return &Client{
+		Client: &http.Client{Transport: &inProcessTransport{mux}},
+		Host:   InProcessHost,
+	}
+}
+
+type inProcessTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip implements the http.RoundTripper interface. It mimics the behaviour
+// of http.Transport and http.Server where it matters: the request gets a
+// RemoteAddr if none was set, the response gets a Content-Length header if
+// none was set, responses to HEAD requests have no body and gzip compression
+// is transparently requested and decoded if the request didn't specify an
+// Accept-Encoding.
+func (transport *inProcessTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	if err := httpReq.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	serverReq := httpReq.Clone(httpReq.Context())
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+	if serverReq.RemoteAddr == "" {
+		serverReq.RemoteAddr = "192.0.2.1:1234"
+	}
+
+	autoGzip := false
+	if serverReq.Method != "HEAD" && serverReq.Header.Get("Accept-Encoding") == "" && serverReq.Header.Get("Range") == "" {
+		serverReq.Header.Set("Accept-Encoding", "gzip")
+		autoGzip = true
+	}
+
+	recorder := httptest.NewRecorder()
+	transport.handler.ServeHTTP(recorder, serverReq)
+
+	httpResp := recorder.Result()
+	httpResp.Request = httpReq
+
+	noBody := httpResp.StatusCode == http.StatusNoContent || httpResp.StatusCode == http.StatusNotModified
+	if !noBody && httpResp.Header.Get("Content-Length") == "" {
+		httpResp.Header.Set("Content-Length", strconv.Itoa(recorder.Body.Len()))
+		httpResp.ContentLength = int64(recorder.Body.Len())
+	}
+
+	if httpReq.Method == "HEAD" {
+		httpResp.Body = http.NoBody
+	}
+
+	if autoGzip && httpResp.Header.Get("Content-Encoding") == "gzip" {
+		body, err := gzip.NewReader(httpResp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		httpResp.Body = body
+		httpResp.Header.Del("Content-Encoding")
+		httpResp.Header.Del("Content-Length")
+		httpResp.ContentLength = -1
+		httpResp.Uncompressed = true
+	}
+
+	return httpResp, nil
+}
+
+// ServeTest serves a request with the given method, path and body via ServeHTTP
+// and returns the recorded response which makes handlers easy to test. A nil
+// body sends no body, []byte bodies are sent as is and other bodies are
+// marshalled to JSON using the FieldNaming of the mux. Only fails if the
+// request can't be created.
+func (mux *Mux) ServeTest(method, path string, body interface{}) (*httptest.ResponseRecorder, error) {
+	mux.Init()
+
+	var reader io.Reader
+	if data, ok := body.([]byte); ok {
+		reader = bytes.NewReader(data)
+
+	} else if body != nil {
+		data, err := mux.encode(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequest(method, path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.RequestURI = path
+	httpReq.RemoteAddr = "192.0.2.1:1234"
+	if reader != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+	return recorder, nil
+}
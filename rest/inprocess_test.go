@@ -0,0 +1,95 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInProcessClient(t *testing.T) {
+	mux := new(Mux)
+	mux.AddService(&TestService{})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	remote := &Client{Host: server.URL, Root: "/map"}
+	local := NewInProcessClient(mux)
+	local.Root = "/map"
+
+	send := func(client *Client, method, path string, body interface{}) *Response {
+		req := client.NewRequest(method).SetPath(path)
+		if body != nil {
+			req.SetBody(body)
+		}
+		return req.Send()
+	}
+
+	checkResp(t, "p(a,1)", send(local, "POST", "/", &KV{"a", "1"}))
+
+	requests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"GET", "/a", nil},
+		{"GET", "/gzip/a", nil},
+		{"HEAD", "/a", nil},
+		{"HEAD", "/gzip/a", nil},
+		{"GET", "/b", nil},
+		{"PUT", "/a", "3"},
+		{"POST", "/", &KV{"a", "2"}},
+		{"POST", "/blah/bleh", nil},
+	}
+
+	for _, req := range requests {
+		title := req.method + " " + req.path
+		exp := send(remote, req.method, req.path, req.body)
+		resp := send(local, req.method, req.path, req.body)
+
+		if resp.Error != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", title, resp.Error)
+			continue
+		}
+
+		if resp.Code != exp.Code {
+			t.Errorf("FAIL(%s): code mismatch %d != %d", title, resp.Code, exp.Code)
+		}
+
+		if string(resp.Body) != string(exp.Body) {
+			t.Errorf("FAIL(%s): body mismatch '%s' != '%s'", title, resp.Body, exp.Body)
+		}
+
+		for _, key := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			if resp.Header.Get(key) != exp.Header.Get(key) {
+				t.Errorf("FAIL(%s): header %s mismatch '%s' != '%s'",
+					title, key, resp.Header.Get(key), exp.Header.Get(key))
+			}
+		}
+
+		errExp, err := exp.GetBody(nil), resp.GetBody(nil)
+		if (err == nil) != (errExp == nil) || (err != nil && err.Type != errExp.Type) {
+			t.Errorf("FAIL(%s): error mismatch %v != %v", title, err, errExp)
+		}
+	}
+}
+
+func TestInProcessClientRemoteAddr(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/remote", "GET", func(httpReq *http.Request) string {
+		return httpReq.RemoteAddr
+	}))
+
+	var remote string
+	resp := NewInProcessClient(mux).NewRequest("GET").SetPath("/remote").Send()
+	if err := resp.GetBody(&remote); err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	}
+
+	if _, _, err := net.SplitHostPort(remote); err != nil {
+		t.Errorf("FAIL: invalid remote address '%s': %s", remote, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultIPResolver is the IPResolver used by ClientIP. It trusts no proxies
+// by default.
+var DefaultIPResolver = new(IPResolver)
+
+// ClientIP returns the IP address of the client that originated the request
+// using DefaultIPResolver.
+func ClientIP(httpReq *http.Request) string {
+	return DefaultIPResolver.ClientIP(httpReq)
+}
+
+// IPResolver determines the IP address of the client that originated a request
+// that might have gone through proxies.
+//
+// The X-Forwarded-For and X-Real-IP headers are only considered if the request
+// comes from a trusted proxy, which prevents clients from forging their
+// address.
+type IPResolver struct {
+
+	// TrustedProxies is the list of networks of the proxies trusted to
+	// provide the address of the client.
+	TrustedProxies []*net.IPNet
+}
+
+// AddTrustedProxy adds the given CIDR (e.g. 10.0.0.0/8) or single IP address to
+// the list of trusted proxies.
+func (resolver *IPResolver) AddTrustedProxy(cidr string) error {
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	resolver.TrustedProxies = append(resolver.TrustedProxies, network)
+	return nil
+}
+
+func (resolver *IPResolver) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range resolver.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that originated the request.
+// The X-Forwarded-For header is walked from the closest hop until an untrusted
+// address is found. Falls back to the X-Real-IP header and finally to the
+// remote address of the request.
+func (resolver *IPResolver) ClientIP(httpReq *http.Request) string {
+	remote := httpReq.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	if !resolver.isTrusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range httpReq.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); len(hop) > 0 {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !resolver.isTrusted(hops[i]) || i == 0 {
+			return hops[i]
+		}
+	}
+
+	if realIP := strings.TrimSpace(httpReq.Header.Get("X-Real-IP")); len(realIP) > 0 {
+		return realIP
+	}
+
+	return remote
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func checkClientIP(t *testing.T, resolver *IPResolver, remote string, header map[string]string, exp string) {
+	httpReq := httptest.NewRequest("GET", "/", nil)
+	httpReq.RemoteAddr = remote
+	for key, value := range header {
+		httpReq.Header.Set(key, value)
+	}
+
+	if ip := resolver.ClientIP(httpReq); ip != exp {
+		t.Errorf("FAIL: unexpected client ip for %s %v: %s != %s", remote, header, ip, exp)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	resolver := new(IPResolver)
+	if err := resolver.AddTrustedProxy("10.0.0.0/8"); err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	if err := resolver.AddTrustedProxy("192.168.1.1"); err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	if err := resolver.AddTrustedProxy("blah"); err == nil {
+		t.Errorf("FAIL: expected error for invalid cidr")
+	}
+
+	xff := "X-Forwarded-For"
+
+	// direct connections
+	checkClientIP(t, resolver, "1.2.3.4:1234", nil, "1.2.3.4")
+	checkClientIP(t, resolver, "[::1]:1234", nil, "::1")
+
+	// single proxy
+	checkClientIP(t, resolver, "10.1.2.3:1234", map[string]string{xff: "1.2.3.4"}, "1.2.3.4")
+	checkClientIP(t, resolver, "10.1.2.3:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "1.2.3.4")
+	checkClientIP(t, resolver, "10.1.2.3:1234", nil, "10.1.2.3")
+
+	// proxy chain with a client-provided entry
+	checkClientIP(t, resolver, "10.1.2.3:1234", map[string]string{xff: "6.6.6.6, 1.2.3.4, 192.168.1.1"}, "1.2.3.4")
+	checkClientIP(t, resolver, "10.1.2.3:1234", map[string]string{xff: "10.0.0.1, 10.0.0.2"}, "10.0.0.1")
+
+	// spoofed headers from untrusted sources
+	checkClientIP(t, resolver, "1.2.3.4:1234", map[string]string{xff: "10.0.0.1"}, "1.2.3.4")
+	checkClientIP(t, resolver, "1.2.3.4:1234", map[string]string{"X-Real-IP": "5.5.5.5"}, "1.2.3.4")
+	checkClientIP(t, DefaultIPResolver, "10.1.2.3:1234", map[string]string{xff: "1.2.3.4"}, "10.1.2.3")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Link is a navigational link to a resource related to the body of a
+// response.
+type Link struct {
+
+	// Rel is the relation type of the link (e.g. self, next, related).
+	Rel string `json:"-"`
+
+	// Href is the URL of the linked resource.
+	Href string `json:"href"`
+}
+
+// linkEscaper percent-encodes the characters of an href which would otherwise
+// end the URI reference of a Link header or split the header in two.
+var linkEscaper = strings.NewReplacer(
+	"<", "%3C", ">", "%3E", ",", "%2C", `"`, "%22", " ", "%20")
+
+// String returns the RFC 8288 representation of the link.
+func (link Link) String() string {
+	return fmt.Sprintf("<%s>; rel=\"%s\"", linkEscaper.Replace(link.Href), link.Rel)
+}
+
+// Links can be returned by a route handler to attach navigational links to the
+// body of a response. Each link is rendered as an RFC 8288 Link header and, if
+// Embed is set, also embedded in a _links field of the JSON body which must
+// then be an object.
+type Links struct {
+
+	// Body is the body of the response.
+	Body interface{}
+
+	// Links is the list of links to attach to the response.
+	Links []Link
+
+	// Embed indicates that the links should also be embedded in the JSON
+	// body under the _links field, keyed by relation. Ignored if the
+	// response is encoded by a codec other than JSON.
+	Embed bool
+}
+
+// WithLinks wraps the body of a response with the given links.
+func WithLinks(body interface{}, links ...Link) Links {
+	return Links{Body: body, Links: links}
+}
+
+func (links Links) augment(resp *response) interface{} {
+	for _, link := range links.Links {
+		resp.addHeader("Link", link.String())
+	}
+
+	if !links.Embed || links.Body == nil || resp.marshal == nil {
+		return links.Body
+	}
+	return &linkedBody{links.Body, links.Links, resp.marshal}
+}
+
+type linkedBody struct {
+	body    interface{}
+	links   []Link
+	marshal func(interface{}) ([]byte, error)
+}
+
+// MarshalJSON splices the _links field at the start of the marshalled body.
+func (linked *linkedBody) MarshalJSON() ([]byte, error) {
+	rels := make(map[string][]Link)
+	for _, link := range linked.links {
+		rels[link.Rel] = append(rels[link.Rel], link)
+	}
+	return embedField(linked.marshal, linked.body, "_links", rels)
+}
+
+// embedField marshals the given body with the given function and splices the
+// given field at the start of the resulting JSON object. Fails if the body
+// isn't an object.
+func embedField(
+	marshal func(interface{}) ([]byte, error),
+	obj interface{}, key string, value interface{}) ([]byte, error) {
+	body, err := marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if body = bytes.TrimSpace(body); len(body) < 2 || body[0] != '{' {
+		return nil, fmt.Errorf("unable to embed %s in non-object body: %s", key, body)
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "{%q:", key)
+	buffer.Write(js)
+	if tail := bytes.TrimSpace(body[1:]); tail[0] != '}' {
+		buffer.WriteString(",")
+	}
+	buffer.Write(body[1:])
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	links := []Link{
+		{Rel: "self", Href: "/items?page=2"},
+		{Rel: "next", Href: "/items?page=3"},
+		{Rel: "related", Href: "http://example.com/docs"},
+	}
+
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/items", "GET", func() Links {
+		return WithLinks(&KV{"a", "1"}, links...)
+	}))
+	mux.AddRoute(NewRoute("/embed", "GET", func() Links {
+		return Links{Body: &KV{"a", "1"}, Links: links[:2], Embed: true}
+	}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/items", nil))
+
+	exp := []string{
+		`</items?page=2>; rel="self"`,
+		`</items?page=3>; rel="next"`,
+		`<http://example.com/docs>; rel="related"`,
+	}
+
+	values := recorder.Header().Values("Link")
+	if len(values) != len(exp) {
+		t.Errorf("FAIL: unexpected Link headers: %v", values)
+	}
+	for i := 0; i < len(exp) && i < len(values); i++ {
+		if values[i] != exp[i] {
+			t.Errorf("FAIL: Link header mismatch: %s != %s", values[i], exp[i])
+		}
+	}
+
+	if body := recorder.Body.String(); body != `{"key":"a","val":"1"}` {
+		t.Errorf("FAIL: unexpected body: %s", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/embed", nil))
+
+	expBody := `{"_links":{"next":[{"href":"/items?page=3"}],"self":[{"href":"/items?page=2"}]},"key":"a","val":"1"}`
+	if body := recorder.Body.String(); body != expBody {
+		t.Errorf("FAIL: unexpected embedded body: %s != %s", body, expBody)
+	}
+
+	if values := recorder.Header().Values("Link"); len(values) != 2 {
+		t.Errorf("FAIL: unexpected embedded Link headers: %v", values)
+	}
+}
+
+func TestLinkEscape(t *testing.T) {
+	link := Link{Rel: "search", Href: `/search?q=a,b <c> "d"`}
+	if exp := `</search?q=a%2Cb%20%3Cc%3E%20%22d%22>; rel="search"`; link.String() != exp {
+		t.Errorf("FAIL: unexpected Link header: %s != %s", link.String(), exp)
+	}
+}
+
+func TestLinksCodec(t *testing.T) {
+	mux := &Mux{Codecs: map[string]Codec{"application/xml": xmlCodec{}}}
+	mux.AddRoute(NewRoute("/embed", "GET", func() Links {
+		return Links{Body: &KV{"a", "1"}, Links: []Link{{Rel: "self", Href: "/embed"}}, Embed: true}
+	}))
+
+	httpReq := httptest.NewRequest("GET", "/embed", nil)
+	httpReq.Header.Set("Accept", "application/xml")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if body := recorder.Body.String(); body != "<KV><Key>a</Key><Val>1</Val></KV>" {
+		t.Errorf("FAIL: unexpected body: %s", body)
+	}
+	if link := recorder.Header().Get("Link"); link != `</embed>; rel="self"` {
+		t.Errorf("FAIL: unexpected Link header: %s", link)
+	}
+}
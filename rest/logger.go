@@ -0,0 +1,9 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+// Logger is the interface used to report errors and warnings. It's
+// implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsSamples is the number of latency samples kept per route to compute
+// the latency percentiles.
+const metricsSamples = 1024
+
+// UnknownRouteMetrics is the key of the metrics of requests that didn't match
+// any routes.
+const UnknownRouteMetrics = "unknown"
+
+// RouteMetrics holds the metrics of a single route.
+type RouteMetrics struct {
+	Route     string  `json:"route"`
+	Count     uint64  `json:"count"`
+	Errors    uint64  `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+
+	// Latency percentiles in milliseconds computed over the most recent
+	// requests.
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// Metrics is a snapshot of the metrics collected by a mux.
+type Metrics struct {
+	Count  uint64          `json:"count"`
+	Errors uint64          `json:"errors"`
+	Routes []*RouteMetrics `json:"routes"`
+}
+
+type routeMetrics struct {
+	count   uint64
+	errors  uint64
+	samples []time.Duration
+}
+
+type metrics struct {
+	mutex  sync.Mutex
+	routes map[string]*routeMetrics
+}
+
+func newMetrics() *metrics {
+	return &metrics{routes: make(map[string]*routeMetrics)}
+}
+
+func (m *metrics) record(route *Route, status int, latency time.Duration) {
+	key := UnknownRouteMetrics
+	if route != nil {
+		key = route.Method + " " + route.Path.String()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats, ok := m.routes[key]
+	if !ok {
+		stats = &routeMetrics{samples: make([]time.Duration, 0, metricsSamples)}
+		m.routes[key] = stats
+	}
+
+	if len(stats.samples) < metricsSamples {
+		stats.samples = append(stats.samples, latency)
+	} else {
+		stats.samples[stats.count%metricsSamples] = latency
+	}
+
+	stats.count++
+	if status >= 400 {
+		stats.errors++
+	}
+}
+
+// Snapshot returns the current state of the metrics.
+func (m *metrics) Snapshot() *Metrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	snapshot := &Metrics{Routes: make([]*RouteMetrics, 0, len(m.routes))}
+
+	for key, stats := range m.routes {
+		samples := append([]time.Duration(nil), stats.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		snapshot.Count += stats.count
+		snapshot.Errors += stats.errors
+		snapshot.Routes = append(snapshot.Routes, &RouteMetrics{
+			Route:     key,
+			Count:     stats.count,
+			Errors:    stats.errors,
+			ErrorRate: float64(stats.errors) / float64(stats.count),
+			P50:       percentile(samples, 0.50),
+			P90:       percentile(samples, 0.90),
+			P99:       percentile(samples, 0.99),
+		})
+	}
+
+	sort.Slice(snapshot.Routes, func(i, j int) bool {
+		return snapshot.Routes[i].Route < snapshot.Routes[j].Route
+	})
+
+	return snapshot
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// statusWriter records the status code written to a http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (writer *statusWriter) WriteHeader(status int) {
+	if writer.status == 0 {
+		writer.status = status
+	}
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (writer *statusWriter) Write(data []byte) (int, error) {
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+	return writer.ResponseWriter.Write(data)
+}
+
+// Status returns the status code written to the response.
+func (writer *statusWriter) Status() int {
+	if writer.status == 0 {
+		return http.StatusOK
+	}
+	return writer.status
+}
+
+// Flush implements the http.Flusher interface so that streaming handlers can
+// flush their response. A no-op if the underlying writer can't be flushed.
+func (writer *statusWriter) Flush() {
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+	http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+// Hijack implements the http.Hijacker interface. Returns an error if the
+// underlying writer doesn't support hijacking.
+func (writer *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(writer.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter which is required by
+// http.ResponseController.
+func (writer *statusWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
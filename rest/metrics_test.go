@@ -0,0 +1,183 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMuxMetricsEndpoint(t *testing.T) {
+	mux := &Mux{DefaultHandler: http.NotFoundHandler()}
+	mux.AddService(&TestService{})
+	mux.EnableMetricsEndpoint("/metrics")
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	checkResp(t, "p(a,1)", client.NewRequest("POST").SetPath("/map").SetBody(&KV{"a", "1"}).Send())
+	for i := 0; i < 3; i++ {
+		client.NewRequest("GET").SetPath("/map/a").Send()
+	}
+	client.NewRequest("GET").SetPath("/map/b").Send()
+	client.NewRequest("GET").SetPath("/blah").Send()
+
+	var metrics Metrics
+	if err := client.NewRequest("GET").SetPath("/metrics").Send().GetBody(&metrics); err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+
+	exp := map[string]RouteMetrics{
+		"POST /map/":     {Count: 1, Errors: 0},
+		"GET /map/:key/": {Count: 4, Errors: 1},
+		"unknown":        {Count: 1, Errors: 1},
+	}
+
+	if metrics.Count != 6 || metrics.Errors != 2 {
+		t.Errorf("FAIL: unexpected totals: %d/%d", metrics.Count, metrics.Errors)
+	}
+
+	if len(metrics.Routes) != len(exp) {
+		t.Errorf("FAIL: unexpected routes: %d != %d", len(metrics.Routes), len(exp))
+	}
+
+	for _, route := range metrics.Routes {
+		if stats, ok := exp[route.Route]; !ok {
+			t.Errorf("FAIL: unexpected route: %s", route.Route)
+
+		} else if route.Count != stats.Count || route.Errors != stats.Errors {
+			t.Errorf("FAIL(%s): unexpected counts: %d/%d != %d/%d",
+				route.Route, route.Count, route.Errors, stats.Count, stats.Errors)
+
+		} else if route.P50 <= 0 || route.P50 > route.P99 {
+			t.Errorf("FAIL(%s): unexpected latencies: %f %f", route.Route, route.P50, route.P99)
+		}
+	}
+
+	if metrics.Routes[0].ErrorRate != 0.25 {
+		t.Errorf("FAIL: unexpected error rate: %f", metrics.Routes[0].ErrorRate)
+	}
+}
+
+func TestMuxObserver(t *testing.T) {
+	type observation struct {
+		route   *Route
+		status  int
+		latency time.Duration
+	}
+	var observed []observation
+
+	mux := &Mux{DefaultHandler: http.NotFoundHandler()}
+	mux.Observer = func(route *Route, status int, latency time.Duration) {
+		observed = append(observed, observation{route, status, latency})
+	}
+
+	slow := NewRoute("/slow", "GET", func() string { time.Sleep(10 * time.Millisecond); return "a" })
+	fail := NewRoute("/fail", "GET", func() error { return fmt.Errorf("fail") })
+	mux.AddRoute(slow, fail)
+
+	for _, path := range []string{"/slow", "/fail", "/unknown"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if len(observed) != 3 {
+		t.Fatalf("FAIL: unexpected number of observations: %d", len(observed))
+	}
+
+	if obs := observed[0]; obs.route != slow || obs.status != http.StatusOK || obs.latency < 10*time.Millisecond {
+		t.Errorf("FAIL(slow): unexpected observation: %s %d %s", obs.route, obs.status, obs.latency)
+	}
+
+	if obs := observed[1]; obs.route != fail || obs.status != http.StatusBadRequest {
+		t.Errorf("FAIL(fail): unexpected observation: %s %d %s", obs.route, obs.status, obs.latency)
+	}
+
+	if obs := observed[2]; obs.route != nil || obs.status != http.StatusNotFound {
+		t.Errorf("FAIL(unknown): unexpected observation: %s %d %s", obs.route, obs.status, obs.latency)
+	}
+}
+
+func TestMuxObserverStreaming(t *testing.T) {
+	observed := make(chan int, 1)
+
+	mux := new(Mux)
+	mux.Observer = func(route *Route, status int, latency time.Duration) { observed <- status }
+
+	flushed := make(chan struct{})
+	mux.AddRoute(NewRoute("/events", "GET", func(writer http.ResponseWriter) {
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			t.Errorf("FAIL: writer doesn't implement http.Flusher: %T", writer)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(writer, "data: first\n\n")
+		flusher.Flush()
+		<-flushed
+		fmt.Fprint(writer, "data: second\n\n")
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	httpResp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	defer httpResp.Body.Close()
+
+	// The first event can only be read before the handler returns if it was
+	// flushed.
+	buffer := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(httpResp.Body, buffer); err != nil || string(buffer) != "data: first\n\n" {
+		t.Errorf("FAIL: unexpected first event: '%s' %v", buffer, err)
+	}
+	close(flushed)
+
+	if rest, _ := ioutil.ReadAll(httpResp.Body); string(rest) != "data: second\n\n" {
+		t.Errorf("FAIL: unexpected second event: '%s'", rest)
+	}
+
+	select {
+	case status := <-observed:
+		if status != http.StatusOK {
+			t.Errorf("FAIL: unexpected observed status: %d", status)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("FAIL: request not observed")
+	}
+}
+
+func TestClientObserver(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/slow", "GET", func() string { time.Sleep(10 * time.Millisecond); return "a" }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var observed []*Response
+	client := &Client{Host: server.URL, Observer: func(resp *Response) { observed = append(observed, resp) }}
+
+	r0 := client.NewRequest("GET").SetPath("/slow").Send()
+	r1 := client.NewRequest("GET").SetPath("/unknown").Send()
+
+	if len(observed) != 2 || observed[0] != r0 || observed[1] != r1 {
+		t.Fatalf("FAIL: unexpected observations: %v", observed)
+	}
+
+	if r0.Code != http.StatusOK || r0.Latency < 10*time.Millisecond {
+		t.Errorf("FAIL(slow): unexpected observation: %d %s", r0.Code, r0.Latency)
+	}
+
+	if r1.Code != http.StatusNotFound {
+		t.Errorf("FAIL(unknown): unexpected observation: %d", r1.Code)
+	}
+}
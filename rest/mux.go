@@ -5,18 +5,43 @@ package rest
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 //go:generate go run templates/include_templates.go
 
+const (
+	// DefaultMaxMultipartMemory is the default value of Mux.MaxMultipartMemory.
+	DefaultMaxMultipartMemory = 32 << 20
+
+	// DefaultCompressMinSize is the default value of Mux.CompressMinSize.
+	DefaultCompressMinSize = 1024
+)
+
+// NoDefaultHandler can be used as the DefaultHandler of a Mux to answer the
+// requests that aren't matched by any routes with an UnknownRoute error instead
+// of delegating them to another handler.
+var NoDefaultHandler http.Handler = new(noDefaultHandler)
+
+type noDefaultHandler struct{}
+
+func (*noDefaultHandler) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
+	http.NotFound(writer, httpReq)
+}
+
 // Mux routes incoming bid requests to the registered routes. Implements
 // the http.Handler interface.
 //
@@ -35,11 +60,174 @@ type Mux struct {
 	// status code of the error object will be used.
 	ErrorFunc func(ErrorType, error) error
 
+	// ResponseFunc is called with the serialized body of every successful
+	// response, before it's compressed and written, and returns the body to
+	// be written instead. The headers of the response can be changed via
+	// the given writer but its Content-Type and Content-Length headers are
+	// set once the hook returns. Not called for routes which write their own
+	// response nor for bodies that are streamed or pre-compressed.
+	ResponseFunc func(route *Route, body []byte, writer http.ResponseWriter) []byte
+
+	// JSONErrors indicates that errors should be returned as JSON objects of
+	// the form {"error":"...","type":"..."} instead of text/plain messages.
+	JSONErrors bool
+
+	// ErrorMarshaler maps error types to functions which produce the status
+	// code and the body of the response for errors of that type. The body is
+	// serialized as JSON and a zero status code keeps the default status code
+	// of the error. Consulted after ErrorFunc and takes precedence over
+	// JSONErrors for the error types in the map.
+	ErrorMarshaler map[ErrorType]func(error) (status int, body interface{})
+
+	// RecoverFunc is called with the recovered value when a route handler
+	// panics and is responsible for writing the response. Defaults to
+	// responding with a 500 status code and a PanicError which goes through
+	// ErrorFunc.
+	RecoverFunc func(http.ResponseWriter, *http.Request, interface{})
+
+	// FieldNaming is the naming policy applied to the untagged fields of
+	// structs serialized in response bodies. Defaults to the standard
+	// encoding/json behaviour. Must be set before calling Init and can't be
+	// changed afterwards.
+	FieldNaming FieldNaming
+
+	// TrimServicePrefix is a path prefix that is removed from the routes of
+	// services mounted via AddServiceAt before the mount prefix is applied.
+	// This is useful when services hardcode a common prefix in their routes
+	// which is now provided by the mount point.
+	TrimServicePrefix string
+
+	// WriteTimeout is the maximum amount of time allowed to write the
+	// response of a request, starting when ServeHTTP is called and therefore
+	// including the time spent in the middlewares registered via Use. It
+	// prevents slow-reading clients from holding a connection indefinitely. It
+	// replaces the WriteTimeout of the http.Server for the requests served by
+	// this mux so long-lived streaming responses should either leave it unset
+	// or extend the deadline after each chunk via ExtendWriteDeadline. Zero
+	// means no per-response deadline.
+	WriteTimeout time.Duration
+
+	// EnableGzip compresses the responses of all routes using gzip when the
+	// client accepts the gzip encoding and the body is larger than
+	// CompressMinSize bytes. Routes with a GzipLevel are always compressed
+	// using their own level, regardless of the size of the body.
+	EnableGzip bool
+
+	// CompressMinSize is the size in bytes that a response body must exceed
+	// to be compressed when EnableGzip is set. Smaller bodies are sent
+	// uncompressed since compressing them wastes CPU and can even make them
+	// bigger. Doesn't apply to routes with a GzipLevel. Defaults to
+	// DefaultCompressMinSize and a negative value compresses all bodies.
+	CompressMinSize int
+
+	// MaxMultipartMemory is the maximum number of bytes of a multipart/form-data
+	// request body that are kept in memory while parsing the form. The
+	// remainder is stored in temporary files on disk which are removed once
+	// the handler returns. Handlers can access the parsed form by declaring a
+	// *http.Request argument. Defaults to DefaultMaxMultipartMemory.
+	MaxMultipartMemory int64
+
+	// MaxBodyBytes is the maximum size of the body of an incoming request,
+	// both as sent and once decompressed. Requests with larger bodies are
+	// rejected with a BodyTooLarge error and a 413 status code. Zero means
+	// unlimited.
+	MaxBodyBytes int64
+
+	// MaxPathLength is the maximum length of the path of an incoming request.
+	// Requests with longer paths are rejected with a 414 status code after
+	// the middlewares registered via Use have run but before CORS handling
+	// and routing. Zero means unlimited.
+	MaxPathLength int
+
+	// CORS enables Cross-Origin Resource Sharing headers on the responses
+	// and answers preflight OPTIONS requests with a 204 status code when
+	// set. Disabled by default.
+	CORS *CORSConfig
+
+	// SuggestRoutes indicates that requests for unknown paths which are close
+	// to the path of a registered route should be answered with a 404 whose
+	// body suggests the closest route instead of being passed to the
+	// DefaultHandler. Meant for development as it leaks the routing table.
+	SuggestRoutes bool
+
+	// Codecs registers additional codecs keyed by the media type they handle.
+	// Request bodies are decoded with the codec matching their Content-Type
+	// header and responses are encoded with the codec preferred by the Accept
+	// header of the request, falling back to the codec of the request body.
+	// JSONCodec is always registered for application/json unless overridden
+	// here and is used when neither header names a registered media type.
+	Codecs map[string]Codec
+
+	// Logger receives the warnings and duplicate route errors reported while
+	// adding routes to the mux and the messages enabled by VerboseRouting
+	// instead of the standard logger of the log package. Initialization
+	// errors are only redirected for routes that weren't initialized before
+	// being added: NewRoute and NewRouteGzip validate their route on creation
+	// and therefore report their errors to the standard logger.
+	Logger Logger
+
+	// VerboseRouting logs, via the Logger, every request that isn't matched by
+	// any routes and is passed to the DefaultHandler. Meant for debugging as
+	// it can be noisy when the DefaultHandler serves many paths.
+	VerboseRouting bool
+
+	// CaseInsensitive indicates that the constant items of the route paths
+	// are matched without regard to case. Arguments are passed to the
+	// handlers as sent by the client. Must be set before any routes are
+	// added.
+	CaseInsensitive bool
+
+	// TrailingSlashRedirect indicates that requests matching a route through
+	// a path that isn't in its canonical form, either because of a trailing
+	// slash or because it differs in case from the route, should be
+	// redirected to the canonical path. GET and HEAD requests are redirected
+	// with a 301 status code and other methods with a 308 status code so that
+	// the body is sent again.
+	TrailingSlashRedirect bool
+
+	// RequestIDHeader is the header holding the ID of each request. The ID is
+	// read from the request, or generated if absent, echoed in the response
+	// and stored in the context of the request where it can be retrieved via
+	// RequestID. Typically set to DefaultRequestIDHeader. Disabled if empty.
+	RequestIDHeader string
+
+	// DisableNoSniff disables the X-Content-Type-Options: nosniff header
+	// which is otherwise added to all responses to prevent browsers from
+	// sniffing the content type of responses.
+	DisableNoSniff bool
+
+	// DefaultHandler is invoked for all requests that aren't matched by any
+	// routes. Defaults to http.DefaultServeMux. Setting it to NoDefaultHandler
+	// answers these requests with an UnknownRoute error and a 404 status code
+	// instead.
 	DefaultHandler http.Handler
 
+	// NotFoundHandler is invoked for all requests that aren't matched by any
+	// routes nor static directories and takes precedence over the
+	// DefaultHandler. Meant to customize the 404 response while the
+	// DefaultHandler delegates the requests to another handler.
+	NotFoundHandler http.Handler
+
+	metrics *metrics
+
+	// Observer is called at the end of every request with the route that
+	// served it, the status code of the response and the time taken to serve
+	// it. The route is nil for requests that didn't match any routes.
+	Observer func(route *Route, status int, latency time.Duration)
+
+	// UnknownMethodHandler is invoked when the path of a request matches a
+	// route but not with the method of the request. Defaults to responding
+	// with a 405 status code and an Allow header listing the methods
+	// registered for the path.
+	UnknownMethodHandler http.Handler
+
 	initialize sync.Once
 
-	router router
+	router     Router
+	statics    []staticRoute
+	middleware []func(http.Handler) http.Handler
+	encode     func(interface{}) ([]byte, error)
+	codecs     map[string]Codec
 }
 
 // Init initializes the object.
@@ -57,6 +245,36 @@ func (mux *Mux) init() {
 	if mux.DefaultHandler == nil {
 		mux.DefaultHandler = http.DefaultServeMux
 	}
+
+	if mux.CompressMinSize == 0 {
+		mux.CompressMinSize = DefaultCompressMinSize
+	}
+
+	if mux.MaxMultipartMemory == 0 {
+		mux.MaxMultipartMemory = DefaultMaxMultipartMemory
+	}
+
+	mux.router.CaseInsensitive = mux.CaseInsensitive
+
+	if mux.FieldNaming != DefaultNaming {
+		mux.encode = mux.FieldNaming.Marshal
+	} else {
+		mux.encode = json.Marshal
+	}
+
+	mux.codecs = map[string]Codec{"application/json": jsonCodec{mux.encode}}
+	for mediaType, codec := range mux.Codecs {
+		mux.codecs[mediaType] = codec
+	}
+}
+
+// printf logs the given message using the Logger of the mux.
+func (mux *Mux) printf(format string, args ...interface{}) {
+	if mux.Logger == nil {
+		log.Printf(format, args...)
+	} else {
+		mux.Logger.Printf(format, args...)
+	}
 }
 
 // AddRoute adds all the given routes to the mux.
@@ -64,10 +282,39 @@ func (mux *Mux) AddRoute(routes ...*Route) {
 	mux.Init()
 
 	for _, route := range routes {
+		if mux.Logger != nil {
+			route.logger = mux.Logger
+		}
+		route.encode = mux.encode
 		mux.router.Add(route)
+
+		if route.inWriter && route.outBody >= 0 {
+			mux.printf("WARNING: handler of route %s takes an http.ResponseWriter; returned body will be ignored", route)
+		}
+	}
+}
+
+// AddRouteSpecs creates and adds a route for each of the given specs. Panics
+// if any of the specs doesn't form a valid route.
+func (mux *Mux) AddRouteSpecs(specs []RouteSpec) {
+	for _, spec := range specs {
+		mux.AddRoute(NewRoute(spec.Path, spec.Method, spec.Handler))
 	}
 }
 
+// EnableMetricsEndpoint registers a GET route at the given path which serves the
+// request counts, error rates and latency percentiles of all the requests
+// processed by the mux as JSON. Metrics are only collected once this function
+// is called which must be done before serving requests.
+func (mux *Mux) EnableMetricsEndpoint(path string) {
+	mux.Init()
+
+	if mux.metrics == nil {
+		mux.metrics = newMetrics()
+	}
+	mux.AddRoute(NewRoute(path, "GET", mux.metrics.Snapshot))
+}
+
 // AddService adds all the routes returned by the Routable objects to the mux.
 func (mux *Mux) AddService(routables ...Routable) {
 	for _, routable := range routables {
@@ -75,36 +322,325 @@ func (mux *Mux) AddService(routables ...Routable) {
 	}
 }
 
+// AddServiceAt adds all the routes returned by the Routable objects to the mux
+// under the given path prefix. The path of each route is normalized according
+// to the following rules, applied in order:
+//
+//   - If TrimServicePrefix is set and the route path starts with it, then it's
+//     removed from the route path.
+//
+//   - If the route path already starts with the mount prefix then it's used
+//     as is which avoids paths like /api/api/users.
+//
+//   - Otherwise the mount prefix is prepended to the route path.
+func (mux *Mux) AddServiceAt(prefix string, routables ...Routable) {
+	mount := NewPath(prefix)
+	trim := NewPath(mux.TrimServicePrefix)
+
+	for _, routable := range routables {
+		for _, route := range routable.RESTRoutes() {
+			path := route.Path
+
+			if len(trim) > 0 && path.HasPrefix(trim) {
+				path = path[len(trim):]
+			}
+
+			if !path.HasPrefix(mount) {
+				path = append(append(Path{}, mount...), path...)
+			}
+
+			mux.AddRoute(route.withPath(path))
+		}
+	}
+}
+
+// Routes returns all the routes registered with the mux sorted by path and
+// method. The paths of the routes are relative to the Root of the mux.
+func (mux *Mux) Routes() Routes {
+	mux.Init()
+
+	return mux.router.Routes()
+}
+
+// URL returns the path of the route with the given name where the arguments of
+// the path template are replaced, in order, by the given arguments. Returns an
+// error if no routes have that name or if the number of arguments doesn't match
+// the template. Trailing optional arguments can be omitted.
+func (mux *Mux) URL(name string, args ...interface{}) (string, error) {
+	for _, route := range mux.Routes() {
+		if route.Name != name {
+			continue
+		}
+
+		required := 0
+		for _, item := range route.Path {
+			if item.IsArg && !item.IsOptional {
+				required++
+			}
+		}
+
+		if n := route.Path.NumArgs(); len(args) < required || len(args) > n {
+			return "", fmt.Errorf("argument count mismatch for route '%s': got %d expected %d", name, len(args), n)
+		}
+
+		var items []string
+		for _, item := range route.Path {
+			if item.IsOptional && len(args) == 0 {
+				break
+			}
+
+			if item.IsCatchAll {
+				segments := strings.Split(fmt.Sprint(args[0]), "/")
+				for j, segment := range segments {
+					segments[j] = url.PathEscape(segment)
+				}
+				items, args = append(items, strings.Join(segments, "/")), args[1:]
+			} else if item.IsArg {
+				items, args = append(items, url.PathEscape(fmt.Sprint(args[0]))), args[1:]
+			} else {
+				items = append(items, item.Name)
+			}
+		}
+
+		return JoinPath(mux.Root, strings.Join(items, "/")), nil
+	}
+
+	return "", fmt.Errorf("unknown route name: '%s'", name)
+}
+
+// canonicalPath returns the given path matched by the given route without a
+// trailing slash and with its constant items spelled as in the route.
+func (mux *Mux) canonicalPath(route *Route, path string) string {
+	items := SplitPath(path[len(mux.Root):])
+	if len(items) == 0 {
+		return mux.Root
+	}
+
+	for i, item := range route.Path {
+		if i >= len(items) || item.IsCatchAll {
+			break
+		}
+		if !item.IsArg {
+			items[i] = item.Name
+		}
+	}
+
+	return JoinPath(mux.Root, strings.Join(items, "/"))
+}
+
 func (mux *Mux) route(method, path string) (*Route, []string, error) {
 	if strings.HasPrefix(path, mux.Root) {
 		sub := path[len(mux.Root):]
-		if route, args := mux.router.Route(method, sub); route != nil {
+		if route, args, ok := mux.router.Match(method, sub); ok {
 			return route, args, nil
 		}
+
+		// HEAD requests are served by the GET route of the path if there's no
+		// dedicated HEAD route. The body is discarded by the http.Server.
+		if method == "HEAD" {
+			if route, args, ok := mux.router.Match("GET", sub); ok {
+				return route, args, nil
+			}
+		}
 	}
 
 	return nil, nil, fmt.Errorf("unknown path: '%s'", path)
 }
 
+// methods returns the sorted list of methods served for the given path which
+// includes HEAD whenever GET is registered since HEAD requests fall back to the
+// GET route.
+func (mux *Mux) methods(path string) []string {
+	if !strings.HasPrefix(path, mux.Root) {
+		return nil
+	}
+
+	methods := mux.router.Methods(path[len(mux.Root):])
+
+	get, head := false, false
+	for _, method := range methods {
+		get = get || method == "GET"
+		head = head || method == "HEAD"
+	}
+
+	if get && !head {
+		methods = append(methods, "HEAD")
+		sort.Strings(methods)
+	}
+	return methods
+}
+
 func (mux *Mux) respondError(writer http.ResponseWriter, errType ErrorType, code int, err error) {
 	if mux.ErrorFunc != nil {
 		err = mux.ErrorFunc(errType, err)
 	}
 
+	if marshaler, ok := mux.ErrorMarshaler[errType]; ok {
+		status, obj := marshaler(err)
+		if status != 0 {
+			code = status
+		}
+
+		mux.writeError(writer, code, obj)
+		return
+	}
+
 	if coded, ok := err.(*CodedError); ok {
 		code = coded.Code
 		err = coded.Sub
 	}
 
+	if mux.JSONErrors {
+		mux.writeError(writer, code, &jsonError{Error: err.Error(), Type: errType})
+		return
+	}
+
 	http.Error(writer, err.Error(), code)
 }
 
+// jsonError is the body of the error responses when JSONErrors is set.
+type jsonError struct {
+	Error string    `json:"error"`
+	Type  ErrorType `json:"type"`
+}
+
+// writeError writes the given object as the JSON body of an error response.
+func (mux *Mux) writeError(writer http.ResponseWriter, code int, obj interface{}) {
+	body, err := mux.encode(obj)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("unable to marshal error: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.FormatInt(int64(len(body)), 10))
+	writer.WriteHeader(code)
+	writer.Write(body)
+}
+
+func (mux *Mux) recover(writer http.ResponseWriter, httpReq *http.Request, recovered interface{}) {
+	if mux.RecoverFunc != nil {
+		mux.RecoverFunc(writer, httpReq, recovered)
+		return
+	}
+
+	err := fmt.Errorf("panic in handler for '%s %s': %v", httpReq.Method, httpReq.URL.Path, recovered)
+	mux.respondError(writer, PanicError, http.StatusInternalServerError, err)
+}
+
+// gzipLevel returns the gzip compression level to apply to the response of the
+// route or 0 if the response shouldn't be compressed. Routes with a GzipLevel
+// are always compressed while the other routes are only compressed when
+// EnableGzip is set and the client accepts the gzip encoding.
+func (mux *Mux) gzipLevel(route *Route, httpReq *http.Request, header http.Header) int {
+	if route.GzipLevel != 0 {
+		return route.GzipLevel
+	}
+
+	if !mux.EnableGzip {
+		return 0
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+	if !acceptsEncoding(httpReq.Header.Get("Accept-Encoding"), "gzip") {
+		return 0
+	}
+	return gzip.DefaultCompression
+}
+
+// ExtendWriteDeadline sets the write deadline of the connection of the given
+// writer to the given duration from now. Streaming handlers can call it after
+// each chunk to keep a long-lived response going while still protecting
+// against stalled clients. A zero duration clears the deadline. Returns an
+// error if the writer doesn't support deadlines.
+func ExtendWriteDeadline(writer http.ResponseWriter, timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return http.NewResponseController(writer).SetWriteDeadline(deadline)
+}
+
 // ServeHTTP services incoming HTTP request by routing them to one of the
 // registered routes. Handles all marshalling of input and outputs as well as
 // any required path parsing.
 func (mux *Mux) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
 	mux.Init()
 
+	if mux.WriteTimeout > 0 {
+		ExtendWriteDeadline(writer, mux.WriteTimeout)
+	}
+
+	if len(mux.RequestIDHeader) > 0 {
+		httpReq = mux.withRequestID(writer, httpReq)
+	}
+
+	if mux.metrics == nil && mux.Observer == nil {
+		mux.handle(writer, httpReq)
+		return
+	}
+
+	t0 := time.Now()
+	statusWriter := &statusWriter{ResponseWriter: writer}
+	route := mux.handle(statusWriter, httpReq)
+	latency := time.Since(t0)
+
+	if mux.metrics != nil {
+		mux.metrics.record(route, statusWriter.Status(), latency)
+	}
+
+	if mux.Observer != nil {
+		mux.Observer(route, statusWriter.Status(), latency)
+	}
+}
+
+// Use adds a middleware which wraps the routing and processing of all requests
+// served by the mux. Middlewares are applied in the order they were added with
+// the first one being the outermost and they run before any validation of the
+// request which allows them to reject requests early. Must be called before
+// serving requests.
+func (mux *Mux) Use(middleware func(http.Handler) http.Handler) {
+	mux.middleware = append(mux.middleware, middleware)
+}
+
+// handle runs the request through the middlewares and, unless one of them
+// short-circuits the request, serves it. Returns the route the request was
+// routed to or nil if no routes matched.
+func (mux *Mux) handle(writer http.ResponseWriter, httpReq *http.Request) (route *Route) {
+	if len(mux.middleware) == 0 {
+		return mux.serve(writer, httpReq)
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		route = mux.serve(writer, httpReq)
+	})
+
+	for i := len(mux.middleware) - 1; i >= 0; i-- {
+		handler = mux.middleware[i](handler)
+	}
+
+	handler.ServeHTTP(writer, httpReq)
+	return
+}
+
+// serve processes the request and returns the route it was routed to or nil if
+// no routes matched.
+func (mux *Mux) serve(writer http.ResponseWriter, httpReq *http.Request) (route *Route) {
+	if !mux.DisableNoSniff {
+		writer.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+
+	if mux.MaxPathLength > 0 && len(httpReq.URL.Path) > mux.MaxPathLength {
+		err := fmt.Errorf("path too long: %d > %d", len(httpReq.URL.Path), mux.MaxPathLength)
+		mux.respondError(writer, PathTooLong, http.StatusRequestURITooLong, err)
+		return
+	}
+
+	if mux.CORS != nil && mux.cors(writer, httpReq) {
+		return
+	}
+
 	if httpReq.URL.Path == "/documentation" {
 		funcMap := make(template.FuncMap)
 		funcMap["Split"] = strings.Split
@@ -115,8 +651,7 @@ func (mux *Mux) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
 			return
 		}
 
-		routes := mux.router.PrintRoutes(make(Routes, 0))
-		sort.Sort(routes)
+		routes := mux.router.Routes()
 
 		page := struct {
 			Host   string
@@ -125,75 +660,236 @@ func (mux *Mux) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
 			httpReq.Host,
 			routes,
 		}
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
 		t.Execute(writer, page)
 		return
 	}
 
 	route, args, err := mux.route(httpReq.Method, httpReq.URL.Path)
 	if err != nil {
-		mux.DefaultHandler.ServeHTTP(writer, httpReq)
+		methods := mux.methods(httpReq.URL.Path)
+
+		if len(methods) == 0 {
+			if static := mux.static(httpReq); static != nil {
+				static.ServeHTTP(writer, httpReq)
+				return
+			}
+
+			if mux.SuggestRoutes {
+				if suggestion := mux.suggestRoute(httpReq.URL.Path); len(suggestion) > 0 {
+					err := fmt.Errorf("unknown path: '%s'; did you mean '%s'?", httpReq.URL.Path, suggestion)
+					mux.respondError(writer, UnknownRoute, http.StatusNotFound, err)
+					return
+				}
+			}
+
+			if mux.NotFoundHandler != nil {
+				mux.NotFoundHandler.ServeHTTP(writer, httpReq)
+				return
+			}
+
+			if mux.DefaultHandler == NoDefaultHandler {
+				mux.respondError(writer, UnknownRoute, http.StatusNotFound, err)
+				return
+			}
+
+			if mux.VerboseRouting {
+				mux.printf("using default handler for '%s %s'", httpReq.Method, httpReq.URL.Path)
+			}
+			mux.DefaultHandler.ServeHTTP(writer, httpReq)
+
+		} else if mux.UnknownMethodHandler != nil {
+			mux.UnknownMethodHandler.ServeHTTP(writer, httpReq)
+
+		} else {
+			writer.Header().Set("Allow", strings.Join(methods, ", "))
+			err := fmt.Errorf("method '%s' not allowed for path '%s'", httpReq.Method, httpReq.URL.Path)
+			mux.respondError(writer, UnknownMethod, http.StatusMethodNotAllowed, err)
+		}
 		return
 	}
 
-	if httpReq.Method != "GET" {
-		if contentType := httpReq.Header.Get("Content-Type"); contentType != "application/json" {
-			err := fmt.Errorf("unsupported content type: got '%s' expected 'application/json'", contentType)
-			mux.respondError(writer, UnsupportedContentType, http.StatusBadRequest, err)
+	if mux.TrailingSlashRedirect {
+		if path := mux.canonicalPath(route, httpReq.URL.Path); path != httpReq.URL.Path {
+			code := http.StatusMovedPermanently
+			if httpReq.Method != "GET" && httpReq.Method != "HEAD" {
+				code = http.StatusPermanentRedirect
+			}
+			if len(httpReq.URL.RawQuery) > 0 {
+				path += "?" + httpReq.URL.RawQuery
+			}
+			http.Redirect(writer, httpReq, path, code)
 			return
 		}
 	}
 
-	var body []byte
-	if contentEncoding := httpReq.Header.Get("Content-Encoding"); contentEncoding == "gzip" {
-		gz, err := gzip.NewReader(httpReq.Body)
-		defer gz.Close()
-		if err != nil {
-			err := fmt.Errorf("decoding gzip content failed: %s", err)
-			mux.respondError(writer, GzipError, http.StatusBadRequest, err)
+	if len(route.Middleware) == 0 {
+		mux.serveRoute(route, args, writer, httpReq)
+		return
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		mux.serveRoute(route, args, writer, httpReq)
+	})
+
+	for i := len(route.Middleware) - 1; i >= 0; i-- {
+		handler = route.Middleware[i](handler)
+	}
+
+	handler.ServeHTTP(writer, httpReq)
+	return
+}
+
+// respondReadError responds with the given error which can occur while reading
+// the body of the request unless it was caused by the MaxBodyBytes limit.
+func (mux *Mux) respondReadError(writer http.ResponseWriter, errType ErrorType, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		mux.bodyTooLarge(writer)
+		return
+	}
+	mux.respondError(writer, errType, http.StatusBadRequest, err)
+}
+
+// bodyTooLarge responds with a BodyTooLarge error for requests whose body
+// exceeds MaxBodyBytes.
+func (mux *Mux) bodyTooLarge(writer http.ResponseWriter) {
+	err := fmt.Errorf("body too large: exceeds %d bytes", mux.MaxBodyBytes)
+	mux.respondError(writer, BodyTooLarge, http.StatusRequestEntityTooLarge, err)
+}
+
+// serveRoute reads the body of the request, invokes the route with the given
+// path arguments and writes the response.
+func (mux *Mux) serveRoute(route *Route, args []string, writer http.ResponseWriter, httpReq *http.Request) {
+	var body io.Reader
+	var err error
+
+	contentType := httpReq.Header.Get("Content-Type")
+	in, ok := mux.requestCodec(contentType)
+
+	if mux.MaxBodyBytes > 0 {
+		if httpReq.ContentLength > mux.MaxBodyBytes {
+			mux.bodyTooLarge(writer)
 			return
 		}
-		body, err = ioutil.ReadAll(gz)
+		httpReq.Body = http.MaxBytesReader(writer, httpReq.Body, mux.MaxBodyBytes)
+	}
+
+	if isMultipartContentType(contentType) {
+		if err := httpReq.ParseMultipartForm(mux.MaxMultipartMemory); err != nil {
+			mux.respondReadError(writer, ReadBodyError, err)
+			return
+		}
+		defer httpReq.MultipartForm.RemoveAll()
+
+	} else if httpReq.Method != "GET" && httpReq.Method != "HEAD" && !ok && (len(contentType) > 0 || httpReq.ContentLength != 0) {
+		err := fmt.Errorf("unsupported content type: got '%s' expected '%s'",
+			contentType, strings.Join(mux.mediaTypes(), "', '"))
+		mux.respondError(writer, UnsupportedContentType, http.StatusBadRequest, err)
+		return
+
+	} else if contentEncoding := httpReq.Header.Get("Content-Encoding"); contentEncoding == "gzip" {
+		gz, err := gzip.NewReader(httpReq.Body)
 		if err != nil {
 			err := fmt.Errorf("decoding gzip content failed: %s", err)
 			mux.respondError(writer, GzipError, http.StatusBadRequest, err)
 			return
 		}
+		defer gz.Close()
+
+		body = gz
+		if mux.MaxBodyBytes > 0 {
+			body = http.MaxBytesReader(writer, ioutil.NopCloser(gz), mux.MaxBodyBytes)
+		}
+
 	} else {
-		var err error
-		body, err = ioutil.ReadAll(httpReq.Body)
-		if err != nil {
-			mux.respondError(writer, ReadBodyError, http.StatusBadRequest, err)
-			return
+		body = httpReq.Body
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			mux.recover(writer, httpReq, recovered)
 		}
+	}()
+
+	if !ok {
+		in = mux.codecs["application/json"]
 	}
+	out := mux.responseCodec(httpReq.Header.Get("Accept"), in)
 
-	resp, restError := route.invoke(args, body)
+	resp, restError := route.invoke(in, out, writer, httpReq, args, body)
 	if restError != nil {
-		mux.respondError(writer, restError.Type, http.StatusBadRequest, restError.Sub)
+		mux.respondReadError(writer, restError.Type, restError.Sub)
+		return
+	}
+
+	if route.inWriter {
+		return
+	}
+
+	header := writer.Header()
+	for key, values := range resp.header {
+		header[key] = append(header[key], values...)
+	}
+
+	if resp.reader != nil {
+		if closer, ok := resp.reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		header.Set("Content-Type", resp.contentType)
+		if resp.code != 0 {
+			writer.WriteHeader(resp.code)
+		}
+		io.Copy(writer, resp.reader)
 		return
 	}
 
-	if len(resp) == 0 {
-		writer.WriteHeader(http.StatusNoContent)
+	if mux.ResponseFunc != nil && len(resp.encoding) == 0 {
+		resp.body = mux.ResponseFunc(route, resp.body, writer)
+		if len(resp.contentType) == 0 {
+			resp.contentType = out.ContentType()
+		}
+	}
+
+	if len(resp.body) == 0 {
+		if resp.code == 0 {
+			resp.code = http.StatusNoContent
+		}
+		writer.WriteHeader(resp.code)
 	} else {
-		header := writer.Header()
+		if len(resp.encoding) > 0 {
+			header.Add("Vary", "Accept-Encoding")
+			if acceptsEncoding(httpReq.Header.Get("Accept-Encoding"), resp.encoding) {
+				header.Set("Content-Encoding", resp.encoding)
 
-		if route.GzipLevel != 0 {
+			} else if resp.body, err = decodeBody(resp.encoding, resp.body); err != nil {
+				err := fmt.Errorf("decoding pre-compressed content failed: %s", err)
+				mux.respondError(writer, ContentEncodingError, http.StatusInternalServerError, err)
+				return
+			}
+
+		} else if level := mux.gzipLevel(route, httpReq, header); level != 0 && (route.GzipLevel != 0 || len(resp.body) > mux.CompressMinSize) {
 			var body bytes.Buffer
-			gz, _ := gzip.NewWriterLevel(&body, route.GzipLevel)
-			_, err := gz.Write(resp)
+			gz, _ := gzip.NewWriterLevel(&body, level)
+			_, err := gz.Write(resp.body)
 			if err != nil {
 				err := fmt.Errorf("decoding gzip content failed: %s", err)
 				mux.respondError(writer, GzipError, http.StatusBadRequest, err)
 				return
 			}
 			gz.Close()
-			resp = body.Bytes()
+			resp.body = body.Bytes()
 			header.Set("Content-Encoding", "gzip")
 		}
 
-		header.Set("Content-Type", "application/json")
-		header.Set("Content-Length", strconv.FormatInt(int64(len(resp)), 10))
-		writer.Write(resp)
+		header.Set("Content-Type", resp.contentType)
+		header.Set("Content-Length", strconv.FormatInt(int64(len(resp.body)), 10))
+		if resp.code != 0 {
+			writer.WriteHeader(resp.code)
+		}
+		writer.Write(resp.body)
 	}
+
+	return
 }
@@ -3,9 +3,19 @@
 package rest
 
 import (
+	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -216,3 +226,1271 @@ func TestMuxSimple(t *testing.T) {
 	checkRespBody(t, "g(a)", r30, &KV{"a", "1"})
 
 }
+
+type RoutesService Routes
+
+func (service RoutesService) RESTRoutes() Routes {
+	return Routes(service)
+}
+
+func checkMuxRoute(t *testing.T, title string, mux *Mux, method, path string, exp bool) {
+	if route, _, _ := mux.route(method, path); (route != nil) != exp {
+		t.Errorf("FAIL(%s): unexpected route for '%s %s': %s", title, method, path, route)
+	}
+}
+
+func TestMuxAddServiceAt(t *testing.T) {
+	h0 := func() {}
+
+	mux := new(Mux)
+	mux.AddServiceAt("/api", RoutesService{
+		NewRoute("/api/users", "GET", h0),
+		NewRoute("/status", "GET", h0),
+	})
+
+	checkMuxRoute(t, "prefixed", mux, "GET", "/api/users", true)
+	checkMuxRoute(t, "mounted", mux, "GET", "/api/status", true)
+	checkMuxRoute(t, "duplicated", mux, "GET", "/api/api/users", false)
+	checkMuxRoute(t, "unmounted", mux, "GET", "/status", false)
+
+	trim := &Mux{TrimServicePrefix: "/v1"}
+	trim.AddServiceAt("/api/v2", RoutesService{
+		NewRoute("/v1/users", "GET", h0),
+		NewRoute("/api/v2/items", "GET", h0),
+	})
+
+	checkMuxRoute(t, "trimmed", trim, "GET", "/api/v2/users", true)
+	checkMuxRoute(t, "trimmed-prefixed", trim, "GET", "/api/v2/items", true)
+	checkMuxRoute(t, "untrimmed", trim, "GET", "/api/v2/v1/users", false)
+}
+
+func TestMuxPreCompressed(t *testing.T) {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	gz.Write([]byte(`{"key":"a","val":"1"}`))
+	gz.Close()
+	compressed := buffer.Bytes()
+
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/cached", "GET", func() *PreCompressed {
+		return &PreCompressed{Encoding: "gzip", Body: compressed}
+	}))
+
+	httpReq := httptest.NewRequest("GET", "/cached", nil)
+	httpReq.Header.Set("Accept-Encoding", "deflate, gzip;q=0.5")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if enc := recorder.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("FAIL(accept): unexpected content encoding: '%s'", enc)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), compressed) {
+		t.Errorf("FAIL(accept): body was re-encoded")
+	}
+	if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("FAIL(accept): unexpected vary header: '%s'", vary)
+	}
+
+	for _, accept := range []string{"", "deflate", "gzip;q=0", "*, gzip;q=0"} {
+		httpReq := httptest.NewRequest("GET", "/cached", nil)
+		httpReq.Header.Set("Accept-Encoding", accept)
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if enc := recorder.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("FAIL(%s): unexpected content encoding: '%s'", accept, enc)
+		}
+		if body := recorder.Body.String(); body != `{"key":"a","val":"1"}` {
+			t.Errorf("FAIL(%s): unexpected body: %s", accept, body)
+		}
+		if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("FAIL(%s): unexpected vary header: '%s'", accept, vary)
+		}
+	}
+}
+
+func TestMuxMaxPathLength(t *testing.T) {
+	mux := &Mux{MaxPathLength: 16}
+	mux.AddService(&TestService{})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("GET").SetPath("/map/%s", strings.Repeat("a", 16)).Send()
+	failResp(t, "long", r0, EndpointError, http.StatusRequestURITooLong)
+
+	r1 := client.NewRequest("GET").SetPath("/map/gzip/a").Send()
+	failResp(t, "short", r1, EndpointError, http.StatusBadRequest)
+}
+
+func TestMuxAddRouteSpecs(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRouteSpecs([]RouteSpec{
+		{"GET", "/specs/a", func() string { return "a" }},
+		{"GET", "/specs/:id", func(id int) int { return id + 1 }},
+		{"PUT", "/specs/:id", func(id int, val string) string { return fmt.Sprintf("%d:%s", id, val) }},
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL, Root: "/specs"}
+
+	var str string
+	var i int
+
+	if err := client.NewRequest("GET").SetPath("/a").Send().GetBody(&str); err != nil || str != "a" {
+		t.Errorf("FAIL(GET a): unexpected result '%s': %v", str, err)
+	}
+
+	if err := client.NewRequest("GET").SetPath("/%d", 10).Send().GetBody(&i); err != nil || i != 11 {
+		t.Errorf("FAIL(GET id): unexpected result %d: %v", i, err)
+	}
+
+	if err := client.NewRequest("PUT").SetPath("/%d", 10).SetBody("b").Send().GetBody(&str); err != nil || str != "10:b" {
+		t.Errorf("FAIL(PUT id): unexpected result '%s': %v", str, err)
+	}
+}
+
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		http.Error(writer, name, http.StatusTeapot)
+	})
+}
+
+func checkHandled(t *testing.T, title string, mux *Mux, method, path, exp string) {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+	if body := strings.TrimSpace(recorder.Body.String()); body != exp {
+		t.Errorf("FAIL(%s): unexpected handler for '%s %s': %s != %s", title, method, path, body, exp)
+	}
+}
+
+func TestMuxUnknownMethodHandler(t *testing.T) {
+	mux := &Mux{
+		DefaultHandler:       namedHandler("default"),
+		UnknownMethodHandler: namedHandler("unknown-method"),
+	}
+	mux.AddRoute(NewRoute("/x", "GET", func() string { return "route" }))
+
+	checkHandled(t, "route", mux, "GET", "/x", `"route"`)
+	checkHandled(t, "unknown-method", mux, "DELETE", "/x", "unknown-method")
+	checkHandled(t, "unknown-path", mux, "GET", "/y", "default")
+}
+
+func TestMuxMethodNotAllowed(t *testing.T) {
+	mux := &Mux{DefaultHandler: namedHandler("default")}
+	mux.AddRoute(NewRoute("/x", "GET", func() string { return "route" }))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/x", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("FAIL: unexpected status code: %d", recorder.Code)
+	}
+	if allow := recorder.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("FAIL: unexpected allow header: '%s'", allow)
+	}
+
+	mux.AddRoute(NewRoute("/x", "PUT", func() {}))
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/x", nil))
+
+	if allow := recorder.Header().Get("Allow"); allow != "GET, HEAD, PUT" {
+		t.Errorf("FAIL(multiple): unexpected allow header: '%s'", allow)
+	}
+
+	mux.AddRoute(
+		NewRoute("/z", "GET", func() string { return "route" }),
+		NewRoute("/z", "HEAD", func() {}))
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/z", nil))
+
+	if allow := recorder.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("FAIL(head): unexpected allow header: '%s'", allow)
+	}
+
+	checkHandled(t, "unknown-path", mux, "GET", "/y", "default")
+}
+
+func TestMuxWriteTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow reader test in short mode")
+	}
+
+	chunk := []byte(strings.Repeat("a", 1<<20))
+	const chunks = 64
+
+	// The chunks are written as is so the deadline only expires once the
+	// client stops reading and the socket buffers are full.
+	mux := &Mux{WriteTimeout: time.Second}
+	mux.AddRoute(NewRoute("/large", "GET", func(writer http.ResponseWriter) {
+		for i := 0; i < chunks; i++ {
+			if _, err := writer.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	httpResp, err := http.Get(server.URL + "/large")
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	defer httpResp.Body.Close()
+
+	time.Sleep(3 * time.Second)
+
+	if data, err := ioutil.ReadAll(httpResp.Body); err == nil || len(data) >= chunks*len(chunk) {
+		t.Errorf("FAIL: expected truncated response: %d/%d bytes, %v", len(data), chunks*len(chunk), err)
+	}
+}
+
+func TestMuxExtendWriteDeadline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow streaming test in short mode")
+	}
+
+	const chunks = 5
+
+	mux := &Mux{WriteTimeout: 100 * time.Millisecond}
+	mux.AddRoute(NewRoute("/stream", "GET", func(writer http.ResponseWriter) {
+		for i := 0; i < chunks; i++ {
+			time.Sleep(150 * time.Millisecond)
+
+			if err := ExtendWriteDeadline(writer, 5*time.Second); err != nil {
+				t.Errorf("FAIL: unable to extend deadline: %s", err)
+				return
+			}
+			fmt.Fprintf(writer, "chunk-%d\n", i)
+			http.NewResponseController(writer).Flush()
+		}
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	httpResp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	}
+	if n := strings.Count(string(data), "chunk-"); n != chunks {
+		t.Errorf("FAIL: unexpected number of chunks: %d != %d\n%s", n, chunks, data)
+	}
+}
+
+func TestMuxDocumentationExamples(t *testing.T) {
+	route := NewRoute("/map", "POST", func(kv KV) *KV { return &kv })
+	route.Example = RouteExample{
+		Request:  &KV{"example-key", "example-val"},
+		Response: &KV{"example-key", "example-val"},
+	}
+
+	var kv KV
+	if err := json.Unmarshal([]byte(route.ExampleRequest()), &kv); err != nil {
+		t.Errorf("FAIL: unable to unmarshal example request: %s", err)
+	}
+	checkInvoke(t, route, `{"key":"example-key","val":"example-val"}`, route.ExampleRequest())
+
+	mux := new(Mux)
+	mux.AddRoute(route)
+	mux.AddRoute(NewRoute("/map/:key", "GET", func(key string) string { return key }))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/documentation", nil))
+	doc := recorder.Body.String()
+
+	for _, exp := range []string{route.ExampleRequest(), route.ExampleResponse()} {
+		if !strings.Contains(doc, html.EscapeString(exp)) {
+			t.Errorf("FAIL: missing example in documentation:\n%s", exp)
+		}
+	}
+
+	if n := strings.Count(doc, `class="example-response"`); n != 1 {
+		t.Errorf("FAIL: unexpected number of example responses: %d", n)
+	}
+
+	type Example struct{ UserID int }
+	named := NewRoute("/user", "GET", func() *Example { return nil })
+	named.Example = RouteExample{Response: &Example{1}}
+
+	mux = &Mux{FieldNaming: SnakeCase}
+	mux.AddRoute(named)
+
+	if exp := "{\n  \"user_id\": 1\n}"; named.ExampleResponse() != exp {
+		t.Errorf("FAIL(naming): unexpected example response:\n%s\n!=\n%s", named.ExampleResponse(), exp)
+	}
+}
+
+func TestMuxContentTypeParams(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/echo", "POST", func(kv KV) *KV { return &kv }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	for _, contentType := range []string{"application/json; charset=utf-8", " application/json ", "Application/JSON;charset=UTF-8"} {
+		req := client.NewRequest("POST").SetPath("/echo").SetBody(&KV{"a", "1"})
+		req.Header.Set("Content-Type", contentType)
+		checkRespBody(t, contentType, req.Send(), &KV{"a", "1"})
+	}
+
+	for _, contentType := range []string{"text/plain", "application/jsonx", ""} {
+		req := client.NewRequest("POST").SetPath("/echo").SetBody(&KV{"a", "1"})
+		req.Header.Set("Content-Type", contentType)
+		failResp(t, contentType, req.Send(), EndpointError, http.StatusBadRequest)
+	}
+}
+
+func TestMuxRequestArg(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/query/:key", "GET", func(httpReq *http.Request, key string) string {
+		return key + "=" + httpReq.URL.Query().Get(key)
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var str string
+	resp := (&Client{Host: server.URL}).NewRequest("GET").SetPath("/query/a").AddParam("a", "1").Send()
+	if err := resp.GetBody(&str); err != nil || str != "a=1" {
+		t.Errorf("FAIL: unexpected result '%s': %v", str, err)
+	}
+}
+
+func TestMuxMaxMultipartMemory(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	mux := &Mux{MaxMultipartMemory: 1024}
+	mux.AddRoute(NewRoute("/upload", "POST", func(httpReq *http.Request) (string, error) {
+		file, header, err := httpReq.FormFile("file")
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		if _, ok := file.(*os.File); !ok {
+			return "", fmt.Errorf("file was not spilled to disk")
+		}
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return "", err
+		} else if !bytes.Equal(data, content) {
+			return "", fmt.Errorf("content mismatch")
+		}
+
+		return fmt.Sprintf("%s:%s:%d", httpReq.FormValue("name"), header.Filename, len(data)), nil
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	form.WriteField("name", "blah")
+	part, _ := form.CreateFormFile("file", "data.bin")
+	part.Write(content)
+	form.Close()
+
+	httpResp, err := http.Post(server.URL+"/upload", form.FormDataContentType(), body)
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	defer httpResp.Body.Close()
+
+	result, _ := ioutil.ReadAll(httpResp.Body)
+	if exp := fmt.Sprintf(`"blah:data.bin:%d"`, len(content)); string(result) != exp {
+		t.Errorf("FAIL: unexpected result: %d %s != %s", httpResp.StatusCode, result, exp)
+	}
+}
+
+func TestMuxResponseWriterArg(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/download/:name", "GET", func(writer http.ResponseWriter, name string) error {
+		if name == "missing" {
+			return fmt.Errorf("unknown file: %s", name)
+		}
+
+		writer.Header().Set("Content-Type", "text/csv")
+		writer.Header().Set("Content-Disposition", "attachment; filename="+name)
+		writer.WriteHeader(http.StatusOK)
+		fmt.Fprintf(writer, "a,b\n1,2\n")
+		return nil
+	}))
+	mux.AddRoute(NewRoute("/ignored", "GET", func(writer http.ResponseWriter) string {
+		writer.Write([]byte("written"))
+		return "ignored"
+	}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/download/data.csv", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "a,b\n1,2\n" {
+		t.Errorf("FAIL(download): unexpected response: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("FAIL(download): unexpected content type: %s", contentType)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/download/missing", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("FAIL(missing): unexpected code: %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/ignored", nil))
+
+	if body := recorder.Body.String(); body != "written" {
+		t.Errorf("FAIL(ignored): unexpected body: %s", body)
+	}
+}
+
+func TestMuxCompressMinSize(t *testing.T) {
+	small := strings.Repeat("a", 10)
+	limit := strings.Repeat("a", 98)
+	large := strings.Repeat("a", 1000)
+
+	mux := &Mux{EnableGzip: true, CompressMinSize: 100}
+	mux.AddRoute(NewRoute("/small", "GET", func() string { return small }))
+	mux.AddRoute(NewRoute("/limit", "GET", func() string { return limit }))
+	mux.AddRoute(NewRoute("/large", "GET", func() string { return large }))
+	mux.AddRoute(NewRouteGzip("/small-gzip", "GET", func() string { return small }, gzip.BestSpeed))
+
+	check := func(path, exp string, compressed bool) {
+		httpReq := httptest.NewRequest("GET", path, nil)
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		body := recorder.Body.Bytes()
+		if encoding := recorder.Header().Get("Content-Encoding"); (encoding == "gzip") != compressed {
+			t.Errorf("FAIL(%s): unexpected content encoding: '%s'", path, encoding)
+			return
+		}
+
+		if compressed {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Errorf("FAIL(%s): invalid gzip body: %s", path, err)
+				return
+			}
+			body, _ = ioutil.ReadAll(reader)
+		}
+
+		if string(body) != `"`+exp+`"` {
+			t.Errorf("FAIL(%s): unexpected body: %s", path, body)
+		}
+	}
+
+	check("/small", small, false)
+	check("/limit", limit, false)
+	check("/large", large, true)
+	check("/small-gzip", small, true)
+}
+
+func TestMuxRecover(t *testing.T) {
+	var errType ErrorType
+	var errMsg string
+
+	mux := &Mux{
+		ErrorFunc: func(t ErrorType, err error) error {
+			errType, errMsg = t, err.Error()
+			return err
+		},
+	}
+	mux.AddRoute(NewRoute("/panic", "GET", func() string { panic("boom") }))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/panic", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("FAIL(default): unexpected status code: %d", recorder.Code)
+	}
+	if errType != PanicError || !strings.Contains(errMsg, "boom") {
+		t.Errorf("FAIL(default): unexpected error: %s %s", errType, errMsg)
+	}
+
+	var recovered interface{}
+	mux.RecoverFunc = func(writer http.ResponseWriter, httpReq *http.Request, value interface{}) {
+		recovered = value
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/panic", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("FAIL(custom): unexpected status code: %d", recorder.Code)
+	}
+	if recovered != "boom" {
+		t.Errorf("FAIL(custom): unexpected recovered value: %v", recovered)
+	}
+}
+
+func TestMuxErrorMarshaler(t *testing.T) {
+	mux := &Mux{
+		ErrorMarshaler: map[ErrorType]func(error) (int, interface{}){
+			HandlerError: func(err error) (int, interface{}) {
+				return http.StatusInternalServerError, map[string]string{"message": "internal error"}
+			},
+			UnsupportedContentType: func(err error) (int, interface{}) {
+				return 0, map[string][]string{"errors": {err.Error()}}
+			},
+		},
+	}
+	mux.AddRoute(
+		NewRoute("/fail", "GET", func() error { return fmt.Errorf("secret") }),
+		NewRoute("/post", "POST", func(obj map[string]string) {}),
+		NewRoute("/num/:n", "GET", func(n int) {}))
+
+	check := func(title string, httpReq *http.Request, code int, contentType, exp string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", title, recorder.Code, code)
+		}
+		if value := recorder.Header().Get("Content-Type"); value != contentType {
+			t.Errorf("FAIL(%s): unexpected content type: '%s' != '%s'", title, value, contentType)
+		}
+		if body := strings.TrimSpace(recorder.Body.String()); body != exp {
+			t.Errorf("FAIL(%s): unexpected body: '%s' != '%s'", title, body, exp)
+		}
+	}
+
+	httpReq := httptest.NewRequest("POST", "/post", strings.NewReader("{}"))
+	httpReq.Header.Set("Content-Type", "text/plain")
+
+	check("handler", httptest.NewRequest("GET", "/fail", nil),
+		http.StatusInternalServerError, "application/json", `{"message":"internal error"}`)
+	check("content-type", httpReq,
+		http.StatusBadRequest, "application/json",
+		`{"errors":["unsupported content type: got 'text/plain' expected 'application/json'"]}`)
+	check("default", httptest.NewRequest("GET", "/num/abc", nil),
+		http.StatusBadRequest, "text/plain; charset=utf-8", `strconv.ParseInt: parsing "abc": invalid syntax`)
+}
+
+func TestMuxTrailingData(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/kv", "POST", func(kv *KV) {}))
+
+	for _, body := range []string{`{"key":"a"}garbage`, `{"key":"a"}{"key":"b"}`} {
+		httpReq := httptest.NewRequest("POST", "/kv", strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("FAIL(%s): unexpected status code: %d", body, recorder.Code)
+		}
+	}
+}
+
+func TestMuxCookieParams(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(&Route{
+		Path:         NewPath("/items/:id"),
+		Method:       "PUT",
+		CookieParams: map[int]string{0: "session", 2: "count"},
+		Handler: func(session string, id int, count int, kv *KV) string {
+			return fmt.Sprintf("%s:%d:%d:%s", session, id, count, kv.Key)
+		},
+	})
+
+	check := func(title string, cookies []*http.Cookie, code int, exp string) {
+		httpReq := httptest.NewRequest("PUT", "/items/10", strings.NewReader(`{"key":"a"}`))
+		httpReq.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			httpReq.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", title, recorder.Code, code)
+		} else if body := recorder.Body.String(); code == http.StatusOK && body != exp {
+			t.Errorf("FAIL(%s): unexpected body: %s != %s", title, body, exp)
+		}
+	}
+
+	check("present", []*http.Cookie{{Name: "session", Value: "abc"}, {Name: "count", Value: "3"}},
+		http.StatusOK, `"abc:10:3:a"`)
+	check("missing", nil, http.StatusOK, `":10:0:a"`)
+	check("mismatch", []*http.Cookie{{Name: "count", Value: "three"}}, http.StatusBadRequest, "")
+}
+
+func TestMuxEnableGzip(t *testing.T) {
+	small := strings.Repeat("a", 10)
+	large := strings.Repeat("a", 2000)
+
+	mux := &Mux{EnableGzip: true}
+	mux.AddRoute(
+		NewRoute("/small", "GET", func() string { return small }),
+		NewRoute("/large", "GET", func() string { return large }),
+		NewRoute("/empty", "GET", func() {}))
+
+	check := func(path, accept, exp string, code int, compressed bool) {
+		httpReq := httptest.NewRequest("GET", path, nil)
+		if len(accept) > 0 {
+			httpReq.Header.Set("Accept-Encoding", accept)
+		}
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s, %s): unexpected status code: %d", path, accept, recorder.Code)
+		}
+
+		body := recorder.Body.Bytes()
+		if encoding := recorder.Header().Get("Content-Encoding"); (encoding == "gzip") != compressed {
+			t.Errorf("FAIL(%s, %s): unexpected content encoding: '%s'", path, accept, encoding)
+			return
+		}
+
+		if length := recorder.Header().Get("Content-Length"); code == http.StatusOK && length != fmt.Sprint(len(body)) {
+			t.Errorf("FAIL(%s, %s): content length mismatch: %s != %d", path, accept, length, len(body))
+		}
+
+		if compressed {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Errorf("FAIL(%s, %s): invalid gzip body: %s", path, accept, err)
+				return
+			}
+			body, _ = ioutil.ReadAll(reader)
+		}
+
+		if string(body) != exp {
+			t.Errorf("FAIL(%s, %s): unexpected body: %s", path, accept, body)
+		}
+	}
+
+	check("/large", "gzip, deflate", `"`+large+`"`, http.StatusOK, true)
+	check("/large", "", `"`+large+`"`, http.StatusOK, false)
+	check("/large", "gzip;q=0", `"`+large+`"`, http.StatusOK, false)
+	check("/small", "gzip", `"`+small+`"`, http.StatusOK, false)
+	check("/empty", "gzip", "", http.StatusNoContent, false)
+}
+
+func TestMuxNoSniff(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/ok", "GET", func() string { return "ok" }),
+		NewRoute("/empty", "GET", func() {}),
+		NewRoute("/fail", "GET", func() error { return fmt.Errorf("fail") }),
+		NewRoute("/panic", "GET", func() { panic("boom") }))
+
+	check := func(method, path, contentType string, sniff bool) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+		if value := recorder.Header().Get("X-Content-Type-Options"); (value == "nosniff") == sniff {
+			t.Errorf("FAIL(%s %s): unexpected nosniff header: '%s'", method, path, value)
+		}
+		if value := recorder.Header().Get("Content-Type"); value != contentType {
+			t.Errorf("FAIL(%s %s): unexpected content type: '%s' != '%s'", method, path, value, contentType)
+		}
+	}
+
+	check("GET", "/ok", "application/json", false)
+	check("GET", "/empty", "", false)
+	check("GET", "/fail", "text/plain; charset=utf-8", false)
+	check("GET", "/panic", "text/plain; charset=utf-8", false)
+	check("DELETE", "/ok", "text/plain; charset=utf-8", false)
+	check("GET", "/documentation", "text/html; charset=utf-8", false)
+
+	mux.DisableNoSniff = true
+	check("GET", "/ok", "application/json", true)
+}
+
+func TestMuxRoutes(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/b", "GET", func() {}),
+		NewRoute("/a/:id", "PUT", func(id int) {}),
+		NewRoute("/a/:id", "GET", func(id int) {}),
+		NewRoute("/a", "POST", func() {}))
+
+	exp := []string{"POST /a/", "GET /a/:id/", "PUT /a/:id/", "GET /b/"}
+
+	routes := mux.Routes()
+	if len(routes) != len(exp) {
+		t.Errorf("FAIL: unexpected routes: %v", routes)
+		return
+	}
+
+	for i, route := range routes {
+		if value := route.Method + " " + route.Path.String(); value != exp[i] {
+			t.Errorf("FAIL: route mismatch at %d: %s != %s", i, value, exp[i])
+		}
+	}
+}
+
+func TestMuxURL(t *testing.T) {
+	mux := &Mux{Root: "/api"}
+	mux.AddRoute(
+		&Route{Name: "item", Path: NewPath("/users/:user/items/:id"), Method: "GET", Handler: func(user string, id int) {}},
+		&Route{Name: "users", Path: NewPath("/users"), Method: "GET", Handler: func() {}},
+		&Route{Name: "files", Path: NewPath("/files/:path..."), Method: "GET", Handler: func(path string) {}},
+		&Route{Name: "section", Path: NewPath("/users/:user/:section?"), Method: "GET", Handler: func(user, section string) {}})
+
+	check := func(name, exp string, args ...interface{}) {
+		if url, err := mux.URL(name, args...); err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", name, err)
+		} else if url != exp {
+			t.Errorf("FAIL(%s): url mismatch: %s != %s", name, url, exp)
+		}
+	}
+
+	fail := func(name string, args ...interface{}) {
+		if url, err := mux.URL(name, args...); err == nil {
+			t.Errorf("FAIL(%s): expected error: %s", name, url)
+		}
+	}
+
+	check("item", "/api/users/bob/items/10", "bob", 10)
+	check("item", "/api/users/a%2Fb/items/10", "a/b", 10)
+	check("users", "/api/users")
+	check("files", "/api/files/a/b%20c", "a/b c")
+	check("section", "/api/users/bob/profile", "bob", "profile")
+	check("section", "/api/users/bob", "bob")
+
+	fail("item", "bob")
+	fail("item", "bob", 10, 20)
+	fail("users", 1)
+	fail("section")
+	fail("unknown")
+}
+
+func TestMuxUse(t *testing.T) {
+	var order []string
+
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+				order = append(order, name+">")
+				next.ServeHTTP(writer, httpReq)
+				order = append(order, "<"+name)
+			})
+		}
+	}
+
+	mux := new(Mux)
+	mux.Use(trace("a"))
+	mux.Use(trace("b"))
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+			if httpReq.Header.Get("Authorization") != "secret" {
+				http.Error(writer, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(writer, httpReq)
+		})
+	})
+	mux.AddRoute(NewRoute("/x", "POST", func(kv KV) string {
+		order = append(order, "handler")
+		return kv.Key
+	}))
+
+	httpReq := httptest.NewRequest("POST", "/x", strings.NewReader(`{"key":"a"}`))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "secret")
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `"a"` {
+		t.Errorf("FAIL(allowed): unexpected response: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if exp := "a> b> handler <b <a"; strings.Join(order, " ") != exp {
+		t.Errorf("FAIL(allowed): unexpected order: %v != %s", order, exp)
+	}
+
+	order = nil
+	httpReq = httptest.NewRequest("POST", "/x", strings.NewReader(`garbage`))
+	httpReq.Header.Set("Content-Type", "text/plain")
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("FAIL(rejected): unexpected status code: %d", recorder.Code)
+	}
+	if exp := "a> b> <b <a"; strings.Join(order, " ") != exp {
+		t.Errorf("FAIL(rejected): unexpected order: %v != %s", order, exp)
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	var order []string
+
+	setHeader := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+				order = append(order, name)
+				writer.Header().Add("X-Middleware", name)
+				next.ServeHTTP(writer, httpReq)
+			})
+		}
+	}
+
+	mux := new(Mux)
+	mux.Use(setHeader("global"))
+	mux.AddRoute(
+		&Route{
+			Path:       NewPath("/admin"),
+			Method:     "GET",
+			Handler:    func() string { return "admin" },
+			Middleware: []func(http.Handler) http.Handler{setHeader("admin"), setHeader("audit")},
+		},
+		NewRoute("/public", "GET", func() string { return "public" }))
+
+	check := func(path string, exp ...string) {
+		order = nil
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("FAIL(%s): unexpected status code: %d", path, recorder.Code)
+		}
+
+		values := recorder.Header().Values("X-Middleware")
+		if strings.Join(values, ",") != strings.Join(exp, ",") || strings.Join(order, ",") != strings.Join(exp, ",") {
+			t.Errorf("FAIL(%s): unexpected middlewares: %v %v != %v", path, values, order, exp)
+		}
+	}
+
+	check("/admin", "global", "admin", "audit")
+	check("/public", "global")
+}
+
+func TestMuxJSONErrors(t *testing.T) {
+	mux := &Mux{JSONErrors: true}
+	mux.AddRoute(
+		NewRoute("/fail", "GET", func() error { return fmt.Errorf("boom") }),
+		NewRoute("/coded", "GET", func() error { return &CodedError{http.StatusConflict, fmt.Errorf("conflict")} }),
+		NewRoute("/num/:n", "GET", func(n int) {}))
+
+	check := func(path string, code int, exp jsonError) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", path, recorder.Code, code)
+		}
+		if value := recorder.Header().Get("Content-Type"); value != "application/json" {
+			t.Errorf("FAIL(%s): unexpected content type: '%s'", path, value)
+		}
+
+		var body jsonError
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Errorf("FAIL(%s): invalid body: %s", path, err)
+		} else if body != exp {
+			t.Errorf("FAIL(%s): unexpected body: %+v != %+v", path, body, exp)
+		}
+	}
+
+	check("/fail", http.StatusBadRequest, jsonError{"boom", HandlerError})
+	check("/coded", http.StatusConflict, jsonError{"conflict", HandlerError})
+	check("/num/a", http.StatusBadRequest, jsonError{`strconv.ParseInt: parsing "a": invalid syntax`, UnmarshalError})
+}
+
+func TestMuxHeadAndPatch(t *testing.T) {
+	kv := KV{"a", "1"}
+
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/kv", "GET", func() (*Links, error) {
+			return &Links{Body: &kv, Links: []Link{{Rel: "self", Href: "/kv"}}}, nil
+		}),
+		NewRoute("/kv", "PATCH", func(patch map[string]string) *KV {
+			if val, ok := patch["val"]; ok {
+				kv.Val = val
+			}
+			return &kv
+		}),
+		NewRoute("/head", "HEAD", func(writer http.ResponseWriter) {
+			writer.Header().Set("X-Head", "dedicated")
+		}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("HEAD").SetPath("/kv").Send()
+	var obj KV
+	if err := r0.GetBody(&obj); err != nil {
+		t.Errorf("FAIL(head): unexpected error: %s", err)
+	}
+	if r0.Code != http.StatusOK || len(r0.Body) != 0 || r0.Header.Get("Link") != `</kv>; rel="self"` {
+		t.Errorf("FAIL(head): unexpected response: %d '%s' %v", r0.Code, r0.Body, r0.Header)
+	}
+
+	r1 := client.NewRequest("HEAD").SetPath("/head").Send()
+	checkResp(t, "head-dedicated", r1)
+	if r1.Header.Get("X-Head") != "dedicated" {
+		t.Errorf("FAIL(head-dedicated): unexpected headers: %v", r1.Header)
+	}
+
+	r2 := client.NewRequest("PATCH").SetPath("/kv").SetBody(map[string]string{"val": "2"}).Send()
+	checkRespBody(t, "patch", r2, &KV{"a", "2"})
+	checkRespBody(t, "get", client.NewRequest("GET").SetPath("/kv").Send(), &KV{"a", "2"})
+}
+
+func TestMuxCatchAll(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/files/:path...", "GET", func(path string) string { return path }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	check := func(title, path, exp string) {
+		var result string
+		if err := client.NewRequest("GET").SetPath(path).Send().GetBody(&result); err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", title, err)
+		} else if result != exp {
+			t.Errorf("FAIL(%s): unexpected path: %s != %s", title, result, exp)
+		}
+	}
+
+	check("nested", "/files/a/b/c", "a/b/c")
+	check("single", "/files/a", "a")
+
+	failResp(t, "absent", client.NewRequest("GET").SetPath("/files").Send(), UnknownRoute, http.StatusNotFound)
+}
+
+func TestMuxOptionalPathArg(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/users/:id/:section?", "POST", func(id int, section string, kv KV) *KV {
+		return &KV{fmt.Sprintf("%d:%s", id, section), kv.Val}
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	checkRespBody(t, "present", client.NewRequest("POST").SetPath("/users/1/profile").SetBody(&KV{"a", "b"}).Send(), &KV{"1:profile", "b"})
+	checkRespBody(t, "absent", client.NewRequest("POST").SetPath("/users/1").SetBody(&KV{"a", "b"}).Send(), &KV{"1:", "b"})
+
+	if routes := mux.Routes(); len(routes) != 1 || routes[0].Path.String() != "/users/:id/:section?/" {
+		t.Errorf("FAIL: unexpected routes: %v", routes)
+	}
+
+	recorder, _ := mux.ServeTest("GET", "/documentation", nil)
+	if n := strings.Count(recorder.Body.String(), `<form id="POST-/users/:id/:section?/">`); n != 1 {
+		t.Errorf("FAIL: route documented %d times", n)
+	}
+}
+
+func TestMuxTrailingSlashRedirect(t *testing.T) {
+	mux := &Mux{Root: "/api", TrailingSlashRedirect: true, CaseInsensitive: true}
+	mux.AddRoute(
+		NewRoute("/users/:id", "GET", func(id string) string { return id }),
+		NewRoute("/users/:id", "POST", func(id string) {}),
+		NewRoute("/files/:path...", "GET", func(path string) string { return path }))
+
+	check := func(method, path string, expCode int, expLocation string) {
+		httpReq := httptest.NewRequest(method, path, nil)
+		httpReq.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != expCode {
+			t.Errorf("FAIL(%s %s): unexpected status code: %d != %d", method, path, recorder.Code, expCode)
+		}
+		if location := recorder.Header().Get("Location"); location != expLocation {
+			t.Errorf("FAIL(%s %s): unexpected location: '%s' != '%s'", method, path, location, expLocation)
+		}
+	}
+
+	check("GET", "/api/users/Bob", http.StatusOK, "")
+	check("GET", "/api/users/Bob/", http.StatusMovedPermanently, "/api/users/Bob")
+	check("GET", "/api/Users/Bob?a=1", http.StatusMovedPermanently, "/api/users/Bob?a=1")
+	check("POST", "/api/USERS/Bob/", http.StatusPermanentRedirect, "/api/users/Bob")
+	check("GET", "/api/files/A/B/", http.StatusMovedPermanently, "/api/files/A/B")
+	check("GET", "/api/Files/A/B", http.StatusMovedPermanently, "/api/files/A/B")
+}
+
+func TestMuxCaseInsensitive(t *testing.T) {
+	mux := &Mux{CaseInsensitive: true}
+	mux.AddRoute(NewRoute("/Users/:id/items", "GET", func(id string) string { return id }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	for _, path := range []string{"/users/AbC/items", "/USERS/AbC/Items/", "/Users/AbC/items"} {
+		var id string
+		if err := client.NewRequest("GET").SetPath(path).Send().GetBody(&id); err != nil {
+			t.Errorf("FAIL(%s): unexpected error: %s", path, err)
+		} else if id != "AbC" {
+			t.Errorf("FAIL(%s): unexpected id: %s", path, id)
+		}
+	}
+
+	strict := new(Mux)
+	strict.AddRoute(NewRoute("/Users/:id", "GET", func(id string) {}))
+	if route, _, err := strict.route("GET", "/users/1"); err == nil {
+		t.Errorf("FAIL(strict): unexpected match: %s", route)
+	}
+}
+
+func TestMuxLogger(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	mux := &Mux{Logger: log.New(buffer, "", 0)}
+
+	mux.AddRoute(NewRoute("/ignored", "GET", func(http.ResponseWriter) string { return "" }))
+	if exp := "WARNING: handler of route { GET /ignored/ func(http.ResponseWriter) string } takes an http.ResponseWriter; returned body will be ignored\n"; buffer.String() != exp {
+		t.Errorf("FAIL(warning): unexpected log: '%s' != '%s'", buffer.String(), exp)
+	}
+
+	buffer.Reset()
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "duplicate route: /ignored/" {
+				t.Errorf("FAIL(duplicate): unexpected panic: %v", recovered)
+			}
+		}()
+		mux.AddRoute(NewRoute("/ignored", "GET", func() {}))
+	}()
+	if exp := "duplicate route: /ignored/\n"; buffer.String() != exp {
+		t.Errorf("FAIL(duplicate): unexpected log: '%s' != '%s'", buffer.String(), exp)
+	}
+
+	buffer.Reset()
+	func() {
+		defer func() { recover() }()
+		mux.AddRoute(&Route{Path: NewPath("/invalid"), Method: "GET", Handler: 1})
+	}()
+	if exp := "invalid handler type for route { GET /invalid/ }: got 'int' expected 'func'\n"; buffer.String() != exp {
+		t.Errorf("FAIL(invalid): unexpected log: '%s' != '%s'", buffer.String(), exp)
+	}
+}
+
+func TestMuxVerboseRouting(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	mux := &Mux{Logger: log.New(buffer, "", 0), DefaultHandler: http.NotFoundHandler()}
+	mux.AddRoute(NewRoute("/a", "GET", func() {}))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+	if buffer.Len() != 0 {
+		t.Errorf("FAIL(quiet): unexpected log: %s", buffer.String())
+	}
+
+	mux.VerboseRouting = true
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+	if exp := "using default handler for 'GET /b'\n"; buffer.String() != exp {
+		t.Errorf("FAIL(verbose): unexpected log: '%s' != '%s'", buffer.String(), exp)
+	}
+}
+
+func TestMuxNoDefaultHandler(t *testing.T) {
+	mux := &Mux{DefaultHandler: NoDefaultHandler}
+	mux.AddRoute(NewRoute("/a", "GET", func() {}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("FAIL(text): unexpected status code: %d", recorder.Code)
+	}
+	if body := recorder.Body.String(); body != "unknown path: '/debug/pprof/'\n" {
+		t.Errorf("FAIL(text): unexpected body: '%s'", body)
+	}
+
+	mux = &Mux{DefaultHandler: NoDefaultHandler, JSONErrors: true}
+	mux.AddRoute(NewRoute("/a", "GET", func() {}))
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/b", nil))
+
+	var body struct{ Error, Type string }
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("FAIL(json): unexpected status code: %d", recorder.Code)
+	} else if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Errorf("FAIL(json): unable to decode body '%s': %s", recorder.Body.String(), err)
+	} else if body.Type != string(UnknownRoute) || body.Error != "unknown path: '/b'" {
+		t.Errorf("FAIL(json): unexpected body: %+v", body)
+	}
+}
+
+func TestMuxNotFoundHandler(t *testing.T) {
+	check := func(title string, mux *Mux, expCode int, expBody string) {
+		mux.AddRoute(NewRoute("/a", "GET", func() {}))
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/b", nil))
+
+		if recorder.Code != expCode || recorder.Body.String() != expBody {
+			t.Errorf("FAIL(%s): unexpected response: %d '%s' != %d '%s'",
+				title, recorder.Code, recorder.Body.String(), expCode, expBody)
+		}
+	}
+
+	notFound := http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.WriteHeader(http.StatusNotFound)
+		writer.Write([]byte("custom"))
+	})
+
+	check("default", &Mux{DefaultHandler: namedHandler("default")}, http.StatusTeapot, "default\n")
+	check("not-found", &Mux{NotFoundHandler: notFound}, http.StatusNotFound, "custom")
+	check("both", &Mux{DefaultHandler: namedHandler("default"), NotFoundHandler: notFound}, http.StatusNotFound, "custom")
+}
+
+func TestMuxMaxBodyBytes(t *testing.T) {
+	mux := &Mux{MaxBodyBytes: 64}
+	mux.AddRoute(NewRoute("/echo", "POST", func(kv KV) *KV { return &kv }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	small, large := &KV{"a", "1"}, &KV{"a", strings.Repeat("x", 500)}
+
+	checkRespBody(t, "small", client.NewRequest("POST").SetPath("/echo").SetBody(small).Send(), small)
+	failResp(t, "large", client.NewRequest("POST").SetPath("/echo").SetBody(large).Send(), EndpointError, http.StatusRequestEntityTooLarge)
+
+	chunked := client.NewRequest("POST").SetPath("/echo")
+	chunked.SetBodyReader(strings.NewReader(`{"key":"a","val":"`+strings.Repeat("x", 500)+`"}`), -1)
+	failResp(t, "chunked", chunked.Send(), EndpointError, http.StatusRequestEntityTooLarge)
+
+	// The limit also applies to the decompressed body.
+	gzipped := client.NewRequest("POST").SetPath("/echo").SetGzipLevel(gzip.BestCompression).SetBody(large)
+	if len(gzipped.Body) > 64 {
+		t.Fatalf("FAIL(gzip): compressed body too large for test: %d", len(gzipped.Body))
+	}
+	failResp(t, "gzip", gzipped.Send(), EndpointError, http.StatusRequestEntityTooLarge)
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (reader *closeRecorder) Close() error {
+	reader.closed = true
+	return nil
+}
+
+func TestMuxRawBody(t *testing.T) {
+	reader := &closeRecorder{Reader: strings.NewReader("streamed")}
+
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/bytes", "GET", func() []byte { return []byte(`"raw"`) }),
+		&Route{Path: NewPath("/csv"), Method: "GET", ContentType: "text/csv", Handler: func() []byte { return []byte("a,b\n") }},
+		NewRoute("/reader", "GET", func() (io.Reader, error) { return reader, nil }),
+		NewRoute("/status", "GET", func() *Status { return WithStatus(http.StatusCreated, strings.NewReader("created")) }))
+
+	check := func(path string, expCode int, expType, expBody string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if recorder.Code != expCode {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", path, recorder.Code, expCode)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != expType {
+			t.Errorf("FAIL(%s): unexpected content type: %s != %s", path, contentType, expType)
+		}
+		if body := recorder.Body.String(); body != expBody {
+			t.Errorf("FAIL(%s): unexpected body: '%s' != '%s'", path, body, expBody)
+		}
+	}
+
+	check("/bytes", http.StatusOK, "application/octet-stream", `"raw"`)
+	check("/csv", http.StatusOK, "text/csv", "a,b\n")
+	check("/reader", http.StatusOK, "application/octet-stream", "streamed")
+	check("/status", http.StatusCreated, "application/octet-stream", "created")
+
+	if !reader.closed {
+		t.Errorf("FAIL(reader): reader wasn't closed")
+	}
+}
+
+func TestMuxResponseFunc(t *testing.T) {
+	mux := &Mux{
+		ResponseFunc: func(route *Route, body []byte, writer http.ResponseWriter) []byte {
+			writer.Header().Set("X-Route", route.Path.String())
+			if len(body) == 0 {
+				body = []byte("null")
+			}
+			return []byte(`{"data":` + string(body) + `}`)
+		},
+	}
+	mux.AddRoute(
+		NewRoute("/kv", "GET", func() *KV { return &KV{"a", "1"} }),
+		NewRoute("/empty", "GET", func() {}),
+		NewRoute("/fail", "GET", func() (*KV, error) { return nil, fmt.Errorf("fail") }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var envelope struct{ Data *KV }
+
+	r0 := client.NewRequest("GET").SetPath("/kv").Send()
+	if err := r0.GetBody(&envelope); err != nil || envelope.Data == nil || *envelope.Data != (KV{"a", "1"}) {
+		t.Errorf("FAIL(kv): unexpected body: '%s' %v", r0.Body, err)
+	}
+	if route := r0.Header.Get("X-Route"); route != "/kv/" {
+		t.Errorf("FAIL(kv): unexpected header: '%s'", route)
+	}
+
+	envelope.Data = &KV{}
+	r1 := client.NewRequest("GET").SetPath("/empty").Send()
+	if err := r1.GetBody(&envelope); err != nil || r1.Code != http.StatusOK || envelope.Data != nil {
+		t.Errorf("FAIL(empty): unexpected response: %d '%s' %v", r1.Code, r1.Body, err)
+	}
+
+	r2 := client.NewRequest("GET").SetPath("/fail").Send()
+	failResp(t, "fail", r2, EndpointError, http.StatusBadRequest)
+	if strings.Contains(string(r2.Body), "data") {
+		t.Errorf("FAIL(fail): envelope applied to error: '%s'", r2.Body)
+	}
+}
+
+func TestMuxPathConstraint(t *testing.T) {
+	mux := &Mux{DefaultHandler: NoDefaultHandler}
+	mux.AddRoute(NewRoute("/users/:id:[0-9]+", "GET", func(id int) int { return id }))
+
+	recorder, _ := mux.ServeTest("GET", "/users/42", nil)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "42" {
+		t.Errorf("FAIL(numeric): unexpected response: %d '%s'", recorder.Code, recorder.Body.String())
+	}
+
+	recorder, _ = mux.ServeTest("GET", "/users/abc", nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("FAIL(alpha): unexpected response: %d '%s'", recorder.Code, recorder.Body.String())
+	}
+}
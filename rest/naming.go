@@ -0,0 +1,246 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// FieldNaming is the policy used to name the JSON fields of structs that don't
+// have an explicit name in their json struct tag.
+type FieldNaming int
+
+const (
+	// DefaultNaming uses the standard encoding/json behaviour where untagged
+	// fields are named after the Go field.
+	DefaultNaming FieldNaming = iota
+
+	// CamelCase names untagged fields in camelCase (e.g. UserID -> userId).
+	CamelCase
+
+	// SnakeCase names untagged fields in snake_case (e.g. UserID -> user_id).
+	SnakeCase
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Marshal serializes the given object to JSON while applying the naming policy.
+//
+// The policy is applied on a best-effort basis: the json struct tag options
+// (name, omitempty and -) are honored and embedded structs are flattened but
+// the field conflict resolution rules of encoding/json are not replicated.
+// Types implementing json.Marshaler or encoding.TextMarshaler are serialized
+// as is.
+func (naming FieldNaming) Marshal(obj interface{}) ([]byte, error) {
+	if naming == DefaultNaming {
+		return json.Marshal(obj)
+	}
+	return json.Marshal(naming.transform(reflect.ValueOf(obj)))
+}
+
+// Rename applies the naming policy to the given Go field name.
+func (naming FieldNaming) Rename(name string) string {
+	var words []string
+	runes := []rune(name)
+
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, curr := runes[i-1], runes[i]
+
+		lowerToUpper := !unicode.IsUpper(prev) && unicode.IsUpper(curr)
+		acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(curr) &&
+			i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+		if lowerToUpper || acronymEnd {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	words = append(words, strings.ToLower(string(runes[start:])))
+
+	switch naming {
+
+	case SnakeCase:
+		return strings.Join(words, "_")
+
+	case CamelCase:
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		return strings.Join(words, "")
+
+	default:
+		return name
+	}
+}
+
+func (naming FieldNaming) transform(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+
+	typ := value.Type()
+	if typ.Implements(jsonMarshalerType) || typ.Implements(textMarshalerType) {
+		return value.Interface()
+	}
+
+	if value.CanAddr() {
+		ptr := reflect.PtrTo(typ)
+		if ptr.Implements(jsonMarshalerType) || ptr.Implements(textMarshalerType) {
+			return value.Addr().Interface()
+		}
+	}
+
+	switch value.Kind() {
+
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return naming.transform(value.Elem())
+
+	case reflect.Struct:
+		var obj namedObject
+		naming.fields(value, &obj)
+		return obj
+
+	case reflect.Map:
+		if value.IsNil() || typ.Key().Kind() != reflect.String {
+			return value.Interface()
+		}
+
+		obj := make(map[string]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			obj[key.String()] = naming.transform(value.MapIndex(key))
+		}
+		return obj
+
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return value.Interface()
+		}
+
+		list := make([]interface{}, value.Len())
+		for i := range list {
+			list[i] = naming.transform(value.Index(i))
+		}
+		return list
+
+	default:
+		return value.Interface()
+	}
+}
+
+func (naming FieldNaming) fields(value reflect.Value, obj *namedObject) {
+	typ := value.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+
+		fieldValue := value.Field(i)
+
+		if field.Anonymous && len(name) == 0 {
+			embedded := fieldValue
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				naming.fields(embedded, obj)
+				continue
+			}
+		}
+
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fieldValue) {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = naming.Rename(field.Name)
+		}
+
+		*obj = append(*obj, namedField{name, naming.transform(fieldValue)})
+	}
+}
+
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return value.IsNil()
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	default:
+		return false
+	}
+}
+
+type namedField struct {
+	name  string
+	value interface{}
+}
+
+// namedObject is an ordered list of fields serialized as a JSON object.
+type namedObject []namedField
+
+// MarshalJSON implements the json.Marshaler interface.
+func (obj namedObject) MarshalJSON() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("{")
+
+	for i, field := range obj {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteString(":")
+
+		js, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(js)
+	}
+
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type NamingBase struct {
+	CreatedAt time.Time
+}
+
+type NamingUser struct {
+	NamingBase
+	UserID     int
+	FirstName  string
+	HTTPServer string
+	Tagged     string `json:"customName"`
+	Empty      string `json:",omitempty"`
+	Skipped    string `json:"-"`
+	Friends    []*NamingUser
+	Attrs      map[string]NamingBase
+	hidden     int
+}
+
+func TestFieldNamingRename(t *testing.T) {
+	check := func(naming FieldNaming, name, exp string) {
+		if result := naming.Rename(name); result != exp {
+			t.Errorf("FAIL: rename mismatch for '%s': %s != %s", name, result, exp)
+		}
+	}
+
+	check(SnakeCase, "UserID", "user_id")
+	check(SnakeCase, "HTTPServer", "http_server")
+	check(SnakeCase, "FirstName", "first_name")
+	check(SnakeCase, "Name", "name")
+	check(SnakeCase, "Value2", "value2")
+	check(CamelCase, "UserID", "userId")
+	check(CamelCase, "HTTPServer", "httpServer")
+	check(CamelCase, "FirstName", "firstName")
+	check(DefaultNaming, "FirstName", "FirstName")
+}
+
+func TestFieldNamingMux(t *testing.T) {
+	created := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := &NamingUser{
+		NamingBase: NamingBase{created},
+		UserID:     1,
+		FirstName:  "bob",
+		HTTPServer: "x",
+		Tagged:     "t",
+		Skipped:    "s",
+		Friends:    []*NamingUser{{UserID: 2}},
+		Attrs:      map[string]NamingBase{"KeyName": {created}},
+		hidden:     3,
+	}
+
+	mux := &Mux{FieldNaming: SnakeCase}
+	mux.AddRoute(NewRoute("/user", "GET", func() *NamingUser { return user }))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/user", nil))
+
+	exp := `{"created_at":"2014-01-02T03:04:05Z","user_id":1,"first_name":"bob","http_server":"x",` +
+		`"customName":"t","friends":[{"created_at":"0001-01-01T00:00:00Z","user_id":2,"first_name":"",` +
+		`"http_server":"","customName":"","friends":null,"attrs":null}],` +
+		`"attrs":{"KeyName":{"created_at":"2014-01-02T03:04:05Z"}}}`
+
+	if body := recorder.Body.String(); body != exp {
+		t.Errorf("FAIL: unexpected body:\n%s\n!=\n%s", body, exp)
+	}
+}
+
+func TestFieldNamingEmbedded(t *testing.T) {
+	type Body struct{ UserID int }
+
+	mux := &Mux{FieldNaming: SnakeCase}
+	mux.AddRoute(NewRoute("/warnings", "GET", func() Warnings {
+		return Warnings{Body: &Body{1}, Warnings: []string{"w"}, Embed: true}
+	}))
+	mux.AddRoute(NewRoute("/links", "GET", func() Links {
+		return Links{Body: &Body{1}, Links: []Link{{Rel: "self", Href: "/links"}}, Embed: true}
+	}))
+
+	check := func(path, exp string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if body := recorder.Body.String(); body != exp {
+			t.Errorf("FAIL(%s): unexpected body:\n%s\n!=\n%s", path, body, exp)
+		}
+	}
+
+	check("/warnings", `{"_warnings":["w"],"user_id":1}`)
+	check("/links", `{"_links":{"self":[{"href":"/links"}]},"user_id":1}`)
+}
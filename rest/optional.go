@@ -0,0 +1,60 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"encoding/json"
+)
+
+// Optional wraps a field of a body struct to detect whether the field was
+// present in the JSON body and whether it was explicitly set to null. This is
+// mostly useful for partial updates (PATCH) where an omitted field must be left
+// untouched while a null field must be cleared:
+//
+//	type UserPatch struct {
+//	    Name  rest.Optional[string] `json:"name"`
+//	    Email rest.Optional[string] `json:"email"`
+//	}
+//
+// A field that is omitted from the body will have Set false. A field that is
+// present will have Set true and, if it was null, Null true with Value left to
+// its zero value.
+type Optional[T any] struct {
+
+	// Set indicates that the field was present in the body.
+	Set bool
+
+	// Null indicates that the field was present in the body with a null value.
+	Null bool
+
+	// Value is the unmarshalled value of the field.
+	Value T
+}
+
+// Some returns an Optional set to the given value.
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Set: true, Value: value}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It is only invoked
+// by the encoding/json package if the field is present in the body.
+func (opt *Optional[T]) UnmarshalJSON(data []byte) error {
+	var value T
+	opt.Set = true
+	opt.Value = value
+	opt.Null = string(data) == "null"
+
+	if opt.Null {
+		return nil
+	}
+	return json.Unmarshal(data, &opt.Value)
+}
+
+// MarshalJSON implements the json.Marshaler interface. Unset and null values
+// are both serialized as null.
+func (opt Optional[T]) MarshalJSON() ([]byte, error) {
+	if !opt.Set || opt.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(opt.Value)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type OptionalPatch struct {
+	A Optional[int]    `json:"a"`
+	B Optional[string] `json:"b"`
+	C Optional[*T]     `json:"c"`
+}
+
+func checkOptional[V comparable](t *testing.T, title string, opt Optional[V], set, null bool, value V) {
+	if opt.Set != set || opt.Null != null || opt.Value != value {
+		t.Errorf("FAIL(%s): unexpected optional {%t %t %v} != {%t %t %v}",
+			title, opt.Set, opt.Null, opt.Value, set, null, value)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	var patch OptionalPatch
+	if err := json.Unmarshal([]byte(`{"a":0,"b":null}`), &patch); err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+
+	checkOptional(t, "set", patch.A, true, false, 0)
+	checkOptional(t, "null", patch.B, true, true, "")
+	checkOptional(t, "omitted", patch.C, false, false, nil)
+
+	if err := json.Unmarshal([]byte(`{"a":"blah"}`), &patch); err == nil {
+		t.Errorf("FAIL: expected unmarshal error")
+	}
+
+	route := NewRoute("/patch", "PATCH", func(patch OptionalPatch) int {
+		if patch.C.Set && !patch.C.Null {
+			return patch.C.Value.Value
+		}
+		return -1
+	})
+	checkInvoke(t, route, "-1", `{"c":null}`)
+	checkInvoke(t, route, "12", `{"c":{"val":12}}`)
+
+	js, err := json.Marshal(OptionalPatch{A: Some(10), B: Optional[string]{Set: true, Null: true}})
+	if err != nil {
+		t.Errorf("FAIL: unexpected marshal error: %s", err)
+	} else if string(js) != `{"a":10,"b":null,"c":null}` {
+		t.Errorf("FAIL: unexpected marshal output: %s", js)
+	}
+}
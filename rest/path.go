@@ -4,23 +4,57 @@ package rest
 
 import (
 	"bytes"
+	"log"
+	"regexp"
 	"strings"
 )
 
 // PathItem represents a single item in a path which can either be an argument
-// or a constant. The name of an argument is used purely for documentation
-// purposes while the name of a constant is its value.
+// or a constant. The name of an argument binds it to the struct field of the
+// handler tagged with the same `rest:"name"`, is returned by Path.ArgNames and
+// shows up in the documentation while Mux.URL fills arguments by position. The
+// name of a constant is its value.
 type PathItem struct {
 	Name  string
 	IsArg bool
+
+	// IsCatchAll indicates that the argument captures all the remaining items
+	// of the path, slashes included. Only valid for the last item of a path.
+	IsCatchAll bool
+
+	// IsOptional indicates that the argument can be absent from the path in
+	// which case the handler receives its zero value. Only valid for trailing
+	// arguments.
+	IsOptional bool
+
+	// Pattern is a regular expression that the whole item must match for the
+	// argument to match. Not supported for catch-all arguments. Empty if the
+	// argument is unconstrained.
+	Pattern string
 }
 
 // String returns the string representation of the item.
 func (item PathItem) String() string {
+	str := item.Name
 	if item.IsArg {
-		return ":" + item.Name
+		str = ":" + str
+	}
+	if item.IsCatchAll {
+		str += "..."
+	}
+	if item.IsOptional {
+		str += "?"
 	}
-	return item.Name
+	if len(item.Pattern) > 0 {
+		str += ":" + item.Pattern
+	}
+	return str
+}
+
+// compilePattern compiles the pattern of a path item such that it must match
+// the whole item.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
 }
 
 // Path is an array of PathItem which represents the templated path of an HTTP
@@ -32,7 +66,24 @@ func (item PathItem) String() string {
 //
 //    /a/:b/c
 //
-// Where a and c are both constants and b is an argument.
+// Where a and c are both constants and b is an argument. The last item of a
+// path can also be a catch-all argument which ends with "..." and captures the
+// remainder of the path as a single argument, slashes included:
+//
+//    /files/:path...
+//
+// A catch-all argument must match at least one item unless it's optional.
+// Trailing arguments can be marked as optional with a "?" suffix so that the
+// path also matches when they're absent:
+//
+//    /users/:id/:section?
+//    /files/:path...?
+//
+// Arguments can also be constrained by a regular expression, following a ':'
+// after the name of the argument, which must match the whole item for the
+// path to match:
+//
+//    /users/:id:[0-9]+
 type Path []PathItem
 
 // SplitPath breaks a REST path into its components.
@@ -51,13 +102,44 @@ func JoinPath(a, b string) string {
 // NewPath breaks up the given path into PathItem to form a new Path object. It
 // panics if it's unable to parse the path.
 func NewPath(rawPath string) (path Path) {
-	for _, item := range SplitPath(rawPath) {
+	items := SplitPath(rawPath)
+
+	for i, item := range items {
 		if item[0] != ':' {
-			path = append(path, PathItem{item, false})
+			if len(path) > 0 && path[len(path)-1].IsOptional {
+				log.Panicf("optional argument must be trailing in path '%s'", rawPath)
+			}
+			path = append(path, PathItem{Name: item})
 			continue
 		}
 
-		path = append(path, PathItem{item[1:], true})
+		arg := PathItem{Name: item[1:], IsArg: true}
+
+		if j := strings.Index(arg.Name, ":"); j >= 0 {
+			arg.Name, arg.Pattern = arg.Name[:j], arg.Name[j+1:]
+			if _, err := compilePattern(arg.Pattern); err != nil {
+				log.Panicf("invalid constraint for argument '%s' in path '%s': %s", arg.Name, rawPath, err)
+			}
+		}
+
+		if name := strings.TrimSuffix(arg.Name, "?"); len(name) < len(arg.Name) {
+			arg.Name, arg.IsOptional = name, true
+		} else if len(path) > 0 && path[len(path)-1].IsOptional {
+			log.Panicf("optional argument must be trailing in path '%s'", rawPath)
+		}
+
+		if name := strings.TrimSuffix(arg.Name, "..."); len(name) < len(arg.Name) {
+			if i != len(items)-1 {
+				log.Panicf("catch-all argument '%s' must be last in path '%s'", item, rawPath)
+			}
+			arg.Name, arg.IsCatchAll = name, true
+
+			if len(arg.Pattern) > 0 {
+				log.Panicf("catch-all argument '%s' can't be constrained in path '%s'", arg.Name, rawPath)
+			}
+		}
+
+		path = append(path, arg)
 	}
 
 	return
@@ -73,6 +155,30 @@ func (path Path) NumArgs() (n int) {
 	return
 }
 
+// ArgNames returns the names of the arguments of the path in order.
+func (path Path) ArgNames() (names []string) {
+	for _, item := range path {
+		if item.IsArg {
+			names = append(names, item.Name)
+		}
+	}
+	return
+}
+
+// HasPrefix returns true if the path starts with all the items of prefix.
+func (path Path) HasPrefix(prefix Path) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i, item := range prefix {
+		if path[i] != item {
+			return false
+		}
+	}
+	return true
+}
+
 // String returns the string representation of the path.
 func (path Path) String() string {
 	buffer := new(bytes.Buffer)
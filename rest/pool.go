@@ -0,0 +1,158 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// PoolStats is a snapshot of the state of the connection pool of a Client
+// created via NewPooledClient.
+type PoolStats struct {
+
+	// Idle is the number of open connections waiting to be reused.
+	Idle int
+
+	// InUse is the number of open connections currently serving a request.
+	InUse int
+
+	// Hosts breaks down the connection counts by dialed address.
+	Hosts map[string]HostPoolStats
+}
+
+// HostPoolStats holds the connection counts for a single dialed address.
+type HostPoolStats struct {
+	Idle  int
+	InUse int
+}
+
+// NewPooledClient creates a Client for the given host whose connections are
+// tracked and can be inspected via the PoolStats method. At most maxIdlePerHost
+// idle connections are kept per host and idle connections are closed after
+// idleTimeout which can be set aggressively to reap unused connections quickly.
+// A zero idleTimeout keeps idle connections open indefinitely.
+func NewPooledClient(host string, maxIdlePerHost int, idleTimeout time.Duration) *Client {
+	pool := &pool{conns: make(map[string]*pooledConn)}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.IdleConnTimeout = idleTimeout
+	transport.DialContext = pool.dial(dialer.DialContext)
+
+	return &Client{
+		Client: &http.Client{Transport: transport},
+		Host:   host,
+		pool:   pool,
+	}
+}
+
+// PoolStats returns the current state of the connection pool. Always returns
+// empty stats for clients that were not created via NewPooledClient.
+func (client *Client) PoolStats() PoolStats {
+	if client.pool == nil {
+		return PoolStats{Hosts: make(map[string]HostPoolStats)}
+	}
+	return client.pool.stats()
+}
+
+type pool struct {
+	mutex sync.Mutex
+	conns map[string]*pooledConn
+}
+
+type pooledConn struct {
+	net.Conn
+
+	pool  *pool
+	key   string
+	addr  string
+	inUse bool
+	once  sync.Once
+}
+
+// connKey identifies a connection by its local address which is preserved by
+// the wrappers of the transport, such as the one used for TLS.
+func connKey(conn net.Conn) string {
+	return conn.LocalAddr().String()
+}
+
+func (pool *pool) dial(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		pooled := &pooledConn{Conn: conn, pool: pool, key: connKey(conn), addr: addr}
+
+		pool.mutex.Lock()
+		pool.conns[pooled.key] = pooled
+		pool.mutex.Unlock()
+
+		return pooled, nil
+	}
+}
+
+func (pool *pool) setInUse(key string, inUse bool) {
+	pool.mutex.Lock()
+	if conn, ok := pool.conns[key]; ok {
+		conn.inUse = inUse
+	}
+	pool.mutex.Unlock()
+}
+
+// trace returns the hooks which track the state of the connection used by a
+// single request.
+func (pool *pool) trace() *httptrace.ClientTrace {
+	var key string
+
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			key = connKey(info.Conn)
+			pool.setInUse(key, true)
+		},
+		PutIdleConn: func(err error) {
+			if err == nil {
+				pool.setInUse(key, false)
+			}
+		},
+	}
+}
+
+func (pool *pool) stats() PoolStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	stats := PoolStats{Hosts: make(map[string]HostPoolStats)}
+
+	for _, conn := range pool.conns {
+		host := stats.Hosts[conn.addr]
+		if conn.inUse {
+			stats.InUse++
+			host.InUse++
+		} else {
+			stats.Idle++
+			host.Idle++
+		}
+		stats.Hosts[conn.addr] = host
+	}
+
+	return stats
+}
+
+// Close removes the connection from the pool before closing it.
+func (conn *pooledConn) Close() error {
+	conn.once.Do(func() {
+		conn.pool.mutex.Lock()
+		delete(conn.pool.conns, conn.key)
+		conn.pool.mutex.Unlock()
+	})
+	return conn.Conn.Close()
+}
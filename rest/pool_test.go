@@ -0,0 +1,68 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitPoolStats(client *Client, idle, inUse int) PoolStats {
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := client.PoolStats()
+		if (stats.Idle == idle && stats.InUse == inUse) || time.Now().After(deadline) {
+			return stats
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientPoolStats(t *testing.T) {
+	block := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		<-block
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewPooledClient(server.URL, 2, 100*time.Millisecond)
+
+	if stats := client.PoolStats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("FAIL(empty): unexpected stats: %+v", stats)
+	}
+
+	done := make(chan *Response)
+	go func() { done <- client.NewRequest("GET").Send() }()
+
+	if stats := waitPoolStats(client, 0, 1); stats.InUse != 1 || stats.Idle != 0 {
+		t.Errorf("FAIL(in-use): unexpected stats: %+v", stats)
+	}
+
+	close(block)
+	checkResp(t, "send", <-done)
+
+	stats := waitPoolStats(client, 1, 0)
+	if stats.Idle != 1 || stats.InUse != 0 {
+		t.Errorf("FAIL(idle): unexpected stats: %+v", stats)
+	}
+	if host := stats.Hosts[server.Listener.Addr().String()]; host.Idle != 1 {
+		t.Errorf("FAIL(idle): unexpected host stats: %+v", stats.Hosts)
+	}
+
+	checkResp(t, "reuse", client.NewRequest("GET").Send())
+	if stats := waitPoolStats(client, 1, 0); stats.Idle != 1 || stats.InUse != 0 {
+		t.Errorf("FAIL(reuse): unexpected stats: %+v", stats)
+	}
+
+	if stats := waitPoolStats(client, 0, 0); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("FAIL(reaped): unexpected stats: %+v", stats)
+	}
+
+	if stats := new(Client).PoolStats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("FAIL(unpooled): unexpected stats: %+v", stats)
+	}
+}
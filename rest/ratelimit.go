@@ -0,0 +1,152 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a middleware which limits the rate of the requests sent by
+// each client using a token bucket per client. Each bucket holds up to Burst
+// tokens and is refilled at Rate tokens per second. Requests which find their
+// bucket empty are rejected with a TooManyRequests error and a 429 status code
+// through the error path of the mux, along with a Retry-After header.
+type RateLimiter struct {
+
+	// Rate is the number of requests per second allowed for each client.
+	Rate float64
+
+	// Burst is the number of requests a client can send at once after being
+	// idle. Defaults to 1.
+	Burst int
+
+	// Key returns the key identifying the client of a request which selects
+	// the bucket of the request. Defaults to ClientIP.
+	Key func(*http.Request) string
+
+	// Clock returns the current time. Defaults to time.Now and can be
+	// replaced to control the refill of the buckets in tests.
+	Clock func() time.Time
+
+	mux *Mux
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter which allows rate requests per second
+// with bursts of up to burst requests for each client and reports rejected
+// requests through the given mux. The limiter is installed via Mux.Use:
+//
+//	mux.Use(rest.NewRateLimiter(mux, 10, 20).Middleware)
+func NewRateLimiter(mux *Mux, rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst, mux: mux}
+}
+
+// Middleware wraps the given handler to reject the requests of clients which
+// exceeded their rate. Can be passed to Mux.Use.
+func (limiter *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		key := ClientIP(httpReq)
+		if limiter.Key != nil {
+			key = limiter.Key(httpReq)
+		}
+
+		if wait, ok := limiter.take(key); !ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+			mux := limiter.mux
+			if mux == nil {
+				mux = new(Mux)
+			}
+			err := fmt.Errorf("rate limit exceeded for '%s'", key)
+			mux.respondError(writer, TooManyRequests, http.StatusTooManyRequests, err)
+			return
+		}
+
+		next.ServeHTTP(writer, httpReq)
+	})
+}
+
+// Allow consumes a token from the bucket of the given key and returns false if
+// the bucket was empty.
+func (limiter *RateLimiter) Allow(key string) bool {
+	_, ok := limiter.take(key)
+	return ok
+}
+
+// take consumes a token from the bucket of the given key or returns the time
+// until the next token is available if the bucket is empty.
+func (limiter *RateLimiter) take(key string) (time.Duration, bool) {
+	now := time.Now()
+	if limiter.Clock != nil {
+		now = limiter.Clock()
+	}
+
+	burst := float64(limiter.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if limiter.buckets == nil {
+		limiter.buckets = make(map[string]*bucket)
+		limiter.swept = now
+	}
+
+	limiter.sweep(now, burst)
+
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		limiter.buckets[key] = b
+	}
+
+	b.refill(now, limiter.Rate, burst)
+
+	if b.tokens < 1 {
+		if limiter.Rate <= 0 {
+			return 0, false
+		}
+		return time.Duration((1 - b.tokens) / limiter.Rate * float64(time.Second)), false
+	}
+
+	b.tokens--
+	return 0, true
+}
+
+// sweep removes the buckets that were refilled to the full burst since they
+// are equivalent to new buckets. Sweeps happen at most once per period needed
+// to refill an empty bucket to keep the cost of the sweeps bounded.
+func (limiter *RateLimiter) sweep(now time.Time, burst float64) {
+	if limiter.Rate <= 0 || now.Sub(limiter.swept).Seconds() < burst/limiter.Rate {
+		return
+	}
+
+	for key, b := range limiter.buckets {
+		if b.refill(now, limiter.Rate, burst); b.tokens >= burst {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.swept = now
+}
+
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.last = now
+	}
+}
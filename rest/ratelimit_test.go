@@ -0,0 +1,92 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	mux := &Mux{JSONErrors: true}
+	limiter := NewRateLimiter(mux, 2, 3)
+	limiter.Clock = func() time.Time { return now }
+	limiter.Key = func(httpReq *http.Request) string { return httpReq.Header.Get("X-Client") }
+
+	mux.Use(limiter.Middleware)
+	mux.AddRoute(NewRoute("/ping", "GET", func() {}))
+
+	send := func(client string) *httptest.ResponseRecorder {
+		httpReq := httptest.NewRequest("GET", "/ping", nil)
+		httpReq.Header.Set("X-Client", client)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httpReq)
+		return recorder
+	}
+
+	check := func(title, client string, exp int) *httptest.ResponseRecorder {
+		recorder := send(client)
+		if recorder.Code != exp {
+			t.Errorf("FAIL(%s): unexpected code: %d != %d", title, recorder.Code, exp)
+		}
+		return recorder
+	}
+
+	for i := 0; i < 3; i++ {
+		check("burst", "a", http.StatusNoContent)
+	}
+
+	r0 := check("throttled", "a", http.StatusTooManyRequests)
+	if retryAfter := r0.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("FAIL(throttled): unexpected Retry-After: '%s'", retryAfter)
+	}
+	if body := r0.Body.String(); body != `{"error":"rate limit exceeded for 'a'","type":"too-many-requests"}` {
+		t.Errorf("FAIL(throttled): unexpected body: '%s'", body)
+	}
+
+	check("other-client", "b", http.StatusNoContent)
+
+	now = now.Add(500 * time.Millisecond)
+	check("refilled", "a", http.StatusNoContent)
+	check("empty", "a", http.StatusTooManyRequests)
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		check("full", "a", http.StatusNoContent)
+	}
+	check("capped", "a", http.StatusTooManyRequests)
+
+	if n := len(limiter.buckets); n != 1 {
+		t.Errorf("FAIL: idle buckets not swept: %d", n)
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	limiter := NewRateLimiter(nil, 1, 1)
+
+	handler := limiter.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {}))
+
+	send := func(remote string) int {
+		httpReq := httptest.NewRequest("GET", "/", nil)
+		httpReq.RemoteAddr = remote
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httpReq)
+		return recorder.Code
+	}
+
+	if code := send("10.0.0.1:1234"); code != http.StatusOK {
+		t.Errorf("FAIL(allowed): unexpected code: %d", code)
+	}
+	if code := send("10.0.0.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("FAIL(throttled): unexpected code: %d", code)
+	}
+	if code := send("10.0.0.2:1234"); code != http.StatusOK {
+		t.Errorf("FAIL(other-ip): unexpected code: %d", code)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the conventional header used to propagate the ID of
+// a request across services.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request stored in the given context by a Mux
+// with a RequestIDHeader or an empty string if none were stored.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID returns a copy of the given context which holds the given
+// request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// withRequestID reads or generates the ID of the request, echoes it in the
+// response and returns the request with the ID stored in its context.
+func (mux *Mux) withRequestID(writer http.ResponseWriter, httpReq *http.Request) *http.Request {
+	id := httpReq.Header.Get(mux.RequestIDHeader)
+	if len(id) == 0 {
+		id = NewRequestID()
+		httpReq.Header.Set(mux.RequestIDHeader, id)
+	}
+
+	writer.Header().Set(mux.RequestIDHeader, id)
+	return httpReq.WithContext(WithRequestID(httpReq.Context(), id))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMuxRequestID(t *testing.T) {
+	mux := &Mux{RequestIDHeader: DefaultRequestIDHeader}
+	mux.AddRoute(NewRoute("/id", "GET", func(ctx context.Context) string { return RequestID(ctx) }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	var id string
+	r0 := client.NewRequest("GET").SetPath("/id").Send()
+	if err := r0.GetBody(&id); err != nil || len(id) != 32 {
+		t.Errorf("FAIL(generated): unexpected id: '%s' %v", id, err)
+	} else if echo := r0.Header.Get(DefaultRequestIDHeader); echo != id {
+		t.Errorf("FAIL(generated): unexpected echo: '%s' != '%s'", echo, id)
+	}
+
+	id = ""
+	r1 := client.NewRequest("GET").SetPath("/id").SetRequestID("abc").Send()
+	if err := r1.GetBody(&id); err != nil || id != "abc" {
+		t.Errorf("FAIL(present): unexpected id: '%s' %v", id, err)
+	} else if echo := r1.Header.Get(DefaultRequestIDHeader); echo != "abc" {
+		t.Errorf("FAIL(present): unexpected echo: '%s'", echo)
+	}
+
+	id = ""
+	ctx := WithRequestID(context.Background(), "def")
+	r2 := client.NewRequest("GET").SetPath("/id").SetContext(ctx).Send()
+	if err := r2.GetBody(&id); err != nil || id != "def" {
+		t.Errorf("FAIL(context): unexpected id: '%s' %v", id, err)
+	}
+
+	other := &Mux{}
+	other.AddRoute(NewRoute("/id", "GET", func() {}))
+
+	recorder := httptest.NewRecorder()
+	other.ServeHTTP(recorder, httptest.NewRequest("GET", "/id", nil))
+	if echo := recorder.Header().Get(DefaultRequestIDHeader); len(echo) > 0 {
+		t.Errorf("FAIL(disabled): unexpected echo: '%s'", echo)
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	if a, b := NewRequestID(), NewRequestID(); a == b {
+		t.Errorf("FAIL: duplicate ids: '%s'", a)
+	}
+}
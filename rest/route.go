@@ -5,11 +5,17 @@ package rest
 import (
 	"github.com/datacratic/gopath/path"
 
+	"bytes"
+	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -40,6 +46,9 @@ func (routes Routes) Swap(i, j int) {
 // and templated path.
 type Route struct {
 
+	// Name identifies the route when generating URLs via Mux.URL. Optional.
+	Name string
+
 	// Path is the templated path required by this route. See Handler for the
 	// rules related to path.
 	Path Path
@@ -51,13 +60,32 @@ type Route struct {
 	// templated path.
 	//
 	// The function can only return at most 2 values where one will be an error
-	// object and the other will be the body of the HTTP response.
+	// object and the other will be the body of the HTTP response. It may also
+	// return 3 values in the order (body, int, error) where the int is the
+	// status code of the HTTP response, 0 selecting the default one. The type of
+	// the body can't contain channels, functions or complex numbers which
+	// can't be marshalled to JSON. Bodies of type []byte or io.Reader are
+	// written verbatim using the ContentType of the route and readers that
+	// implement io.Closer are closed once copied.
 	//
 	// The function needs enough arguments to accept the Path arguments and,
 	// optionally, the body of the request. The path arguments will be applied
 	// in the same order as the function arguments with the last function
 	// argument being the body.
 	//
+	// Alternatively, all the path arguments can be bound to a single struct
+	// argument, placed where the first path argument would be, whose fields
+	// are tagged with the name of the path argument they receive, e.g.
+	// `rest:"id"`. Every path argument must have a matching exported field.
+	//
+	// The function may also declare leading arguments of type *http.Request,
+	// context.Context or http.ResponseWriter, in any order, which are injected
+	// with the incoming HTTP request, its context and the writer of the HTTP
+	// response. These arguments must come before the path arguments and are
+	// not counted as path arguments. A handler that takes an
+	// http.ResponseWriter is responsible for writing the whole response and
+	// any body it returns is ignored; returned errors are still reported.
+	//
 	// If any of the previous rules are broken, Route will panic when Init is
 	// called.
 	Handler interface{}
@@ -65,17 +93,77 @@ type Route struct {
 	// GzipLevel is used to set the response gzip compression level.
 	GzipLevel int
 
+	// Example holds example payloads for the route which are used to
+	// document the route. The examples are serialized the same way as the
+	// bodies of actual requests and responses, including the FieldNaming of
+	// the mux the route is added to.
+	Example RouteExample
+
+	// Middleware is a list of middlewares which wrap the processing of the
+	// requests routed to this route, including the reading of their body.
+	// They're applied in order with the first one being the outermost and
+	// run within the middlewares registered via Mux.Use.
+	Middleware []func(http.Handler) http.Handler
+
+	// Priority is used to pick a route when multiple routes match the path of
+	// a request. The route with the highest priority wins and, in case of a
+	// tie, constant path components take precedence over variable ones.
+	// Defaults to 0.
+	Priority int
+
+	// ContentType is the content type of the []byte and io.Reader bodies
+	// returned by the handler which are written verbatim instead of being
+	// serialized. Defaults to application/octet-stream.
+	ContentType string
+
+	// CookieParams maps the index of handler arguments to the name of the
+	// cookie they are parsed from. These arguments can be placed anywhere
+	// after the injected arguments and are not counted as path arguments or
+	// as the body. Missing cookies leave the argument to its zero value.
+	CookieParams map[int]string
+
 	initialize sync.Once
 
+	// logger receives the errors detected while initializing the route. Set
+	// by Mux.AddRoute and defaults to the standard logger.
+	logger Logger
+
+	// encode serializes the examples of the route in the documentation. Set
+	// by Mux.AddRoute to follow the field naming of the mux and defaults to
+	// json.Marshal.
+	encode func(interface{}) ([]byte, error)
+
 	handler     reflect.Value
 	handlerType reflect.Type
 	bodyType    reflect.Type
 
-	inBody   int
-	outBody  int
-	outError int
+	// structFields holds the index of the struct field bound to each path
+	// argument if the path arguments are bound to a struct.
+	structFields []int
+
+	inSpecial int
+	inPath    int
+	inStruct  int
+	inWriter  bool
+	inBody    int
+	outBody   int
+	outStatus int
+	outError  int
 }
 
+var (
+	requestType = reflect.TypeOf((*http.Request)(nil))
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	writerType  = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	bytesType  = reflect.TypeOf([]byte(nil))
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	intType    = reflect.TypeOf(int(0))
+)
+
 // NewRoute creates and initializes a new Route from the method, path and
 // handler.
 func NewRoute(path, method string, handler interface{}) *Route {
@@ -88,6 +176,24 @@ func NewRoute(path, method string, handler interface{}) *Route {
 	return route
 }
 
+// RouteExample holds example payloads for a route.
+type RouteExample struct {
+
+	// Request is an example of the body of a request.
+	Request interface{}
+
+	// Response is an example of the body of a response.
+	Response interface{}
+}
+
+// RouteSpec describes a route as plain data which can be used to register
+// routes in bulk via Mux.AddRouteSpecs.
+type RouteSpec struct {
+	Method  string
+	Path    string
+	Handler interface{}
+}
+
 // NewRouteGzip creates and initializea a new Route from the method, path and
 // handler. And will gzip compress the returned value.
 func NewRouteGzip(path, method string, handler interface{}, level int) *Route {
@@ -111,52 +217,237 @@ func (route *Route) init() {
 	route.handlerType = route.handler.Type()
 
 	if route.handlerType.Kind() != reflect.Func {
-		log.Panicf("invalid handler type for route { %s %s }: got '%s' expected '%s'",
+		route.panicf("invalid handler type for route { %s %s }: got '%s' expected '%s'",
 			route.Method, route.Path, route.handlerType.Kind(), reflect.Func)
 	}
 
+	route.inSpecial = 0
+	for route.inSpecial < route.handlerType.NumIn() {
+		in := route.handlerType.In(route.inSpecial)
+		if in == writerType {
+			route.inWriter = true
+		} else if in != requestType && in != contextType {
+			break
+		}
+		route.inSpecial++
+	}
+
+	for i, name := range route.CookieParams {
+		if i < route.inSpecial || i >= route.handlerType.NumIn() {
+			route.panicf("invalid argument index for cookie '%s' of route { %s %s }: %d",
+				name, route.Method, route.Path, i)
+		}
+	}
+
+	for _, item := range route.Path {
+		if len(item.Pattern) == 0 {
+			continue
+		}
+		if _, err := compilePattern(item.Pattern); err != nil {
+			route.panicf("invalid constraint for argument '%s' of route { %s %s }: %s",
+				item.Name, route.Method, route.Path, err)
+		}
+	}
+
 	pathArgs := route.Path.NumArgs()
-	handlerArgs := route.handlerType.NumIn()
+	route.inPath = pathArgs
+
+	route.inStruct = -1
+	route.structFields = nil
+	if pathArgs > 0 {
+		i := route.inSpecial
+		for _, ok := route.CookieParams[i]; ok; _, ok = route.CookieParams[i] {
+			i++
+		}
+
+		if i < route.handlerType.NumIn() && isPathStruct(route.handlerType.In(i)) {
+			route.inStruct, route.inPath, pathArgs = i, 1, 1
+			route.structFields = route.pathFields(route.handlerType.In(i))
+		}
+	}
+
+	handlerArgs := route.handlerType.NumIn() - route.inSpecial - len(route.CookieParams)
 
 	if pathArgs < handlerArgs-1 {
-		log.Panicf("not enough path arguments for route { %s %s }: %d < %d",
+		route.panicf("not enough path arguments for route { %s %s }: %d < %d",
 			route.Method, route.Path, pathArgs, handlerArgs-1)
 
 	} else if pathArgs > handlerArgs {
-		log.Panicf("too many path arguments for route { %s %s }: %d > %d",
+		route.panicf("too many path arguments for route { %s %s }: %d > %d",
 			route.Method, route.Path, pathArgs, handlerArgs)
 
 	} else if pathArgs < handlerArgs {
-		route.inBody = handlerArgs
+		route.inBody = route.handlerType.NumIn()
+		for _, ok := route.CookieParams[route.inBody-1]; ok; _, ok = route.CookieParams[route.inBody-1] {
+			route.inBody--
+		}
 		route.bodyType = route.handlerType.In(route.inBody - 1)
 	}
 
-	if route.handlerType.NumOut() > 2 {
-		log.Panicf("too many return arguments for route %s", route)
+	if route.handlerType.NumOut() > 3 {
+		route.panicf("too many return arguments for route %s", route)
 	}
 
 	route.outBody = -1
+	route.outStatus = -1
 	route.outError = -1
 
+	if route.handlerType.NumOut() == 3 {
+		if route.handlerType.Out(1) != intType || route.handlerType.Out(2) != errorType {
+			route.panicf("invalid return arguments for route %s: expected (body, int, error)", route)
+		}
+		route.outStatus = 1
+	}
+
 	for i := 0; i < route.handlerType.NumOut(); i++ {
-		errorType := reflect.TypeOf((*error)(nil)).Elem()
+		if i == route.outStatus {
+			continue
+		}
 
 		if out := route.handlerType.Out(i); out == errorType {
 			if route.outError >= 0 {
-				log.Panicf("too many error return for route %s", route)
+				route.panicf("too many error return for route %s", route)
 			}
 			route.outError = i
 
 		} else {
 			if route.outBody >= 0 {
-				log.Panicf("too many normal return for route %s", route)
+				route.panicf("too many normal return for route %s", route)
 			}
 			route.outBody = i
+
+			// Raw bodies are written verbatim and never marshalled.
+			if out == bytesType || out.Implements(readerType) || route.inWriter {
+				continue
+			}
+
+			if invalid := unmarshalableType(out, make(map[reflect.Type]bool)); invalid != nil {
+				route.panicf("unserializable return type for route %s: '%s' can't be marshalled to JSON", route, invalid)
+			}
 		}
 	}
 }
 
+// unmarshalableType returns the type nested within the given type that can't be
+// marshalled to JSON or nil if none were found. Interfaces are assumed to be
+// marshallable since their dynamic types are only known at runtime.
+func unmarshalableType(typ reflect.Type, visited map[reflect.Type]bool) reflect.Type {
+	if visited[typ] {
+		return nil
+	}
+	visited[typ] = true
+
+	if typ.Implements(jsonMarshalerType) || reflect.PtrTo(typ).Implements(jsonMarshalerType) ||
+		typ.Implements(textMarshalerType) || reflect.PtrTo(typ).Implements(textMarshalerType) {
+		return nil
+	}
+
+	switch typ.Kind() {
+
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return typ
+
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return unmarshalableType(typ.Elem(), visited)
+
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" && !field.Anonymous || field.Tag.Get("json") == "-" {
+				continue
+			}
+			if invalid := unmarshalableType(field.Type, visited); invalid != nil {
+				return invalid
+			}
+		}
+	}
+
+	return nil
+}
+
+func (route *Route) rawContentType() string {
+	if len(route.ContentType) == 0 {
+		return "application/octet-stream"
+	}
+	return route.ContentType
+}
+
+// isPathStruct returns true if the given type is a struct with at least one
+// field tagged with the name of a path argument.
+func isPathStruct(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := typ.Field(i).Tag.Lookup("rest"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathFields returns the index of the field of the given struct type that is
+// bound to each path argument.
+func (route *Route) pathFields(typ reflect.Type) (fields []int) {
+	for _, name := range route.Path.ArgNames() {
+		field := -1
+		for i := 0; i < typ.NumField(); i++ {
+			if typ.Field(i).Tag.Get("rest") == name {
+				field = i
+				break
+			}
+		}
+
+		if field < 0 || typ.Field(field).PkgPath != "" {
+			route.panicf("no exported field of '%s' bound to path argument '%s' for route { %s %s }",
+				typ, name, route.Method, route.Path)
+		}
+		fields = append(fields, field)
+	}
+	return
+}
+
+// panicf is the equivalent of log.Panicf for the logger of the route.
+func (route *Route) panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if route.logger == nil {
+		log.Print(msg)
+	} else {
+		route.logger.Printf("%s", msg)
+	}
+	panic(msg)
+}
+
+// withPath returns a new copy of the route with the given path.
+func (route *Route) withPath(path Path) *Route {
+	clone := &Route{
+		Name:         route.Name,
+		Path:         path,
+		Method:       route.Method,
+		Handler:      route.Handler,
+		GzipLevel:    route.GzipLevel,
+		Priority:     route.Priority,
+		Example:      route.Example,
+		ContentType:  route.ContentType,
+		CookieParams: route.CookieParams,
+		Middleware:   route.Middleware,
+		logger:       route.logger,
+		encode:       route.encode,
+	}
+	return clone
+}
+
 func (route *Route) parseArg(data string, value reflect.Value) (err error) {
+	if value.Kind() == reflect.Ptr && value.Type().Implements(textUnmarshalerType) {
+		value.Set(reflect.New(value.Type().Elem()))
+		return value.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(data))
+	}
+
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(data))
+	}
+
 	switch value.Kind() {
 
 	case reflect.String:
@@ -186,6 +477,23 @@ func (route *Route) parseArg(data string, value reflect.Value) (err error) {
 			value.SetFloat(f)
 		}
 
+	case reflect.Slice:
+		var items []string
+		if len(data) > 0 {
+			items = strings.Split(data, ",")
+		}
+
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err = route.parseArg(item, slice.Index(i)); err != nil {
+				return
+			}
+		}
+		value.Set(slice)
+
+	case reflect.Map:
+		err = json.Unmarshal([]byte(data), value.Addr().Interface())
+
 	default:
 		err = fmt.Errorf("unsupported argument type for route '%s %s': %s",
 			route.Method, route.Path, value.Kind())
@@ -209,42 +517,174 @@ func (route *Route) isNil(obj reflect.Value) bool {
 	}
 }
 
-func (route *Route) invoke(args []string, body []byte) ([]byte, *Error) {
+// response holds the result of a route invocation.
+type response struct {
+	body []byte
+
+	// encoding is the content encoding of a pre-encoded body.
+	encoding string
+
+	// contentType is the media type of the body.
+	contentType string
+
+	// reader streams the body of the response in place of body when the
+	// handler returned an io.Reader.
+	reader io.Reader
+
+	// header holds additional headers to be added to the HTTP response. Can
+	// be nil.
+	header http.Header
+
+	// code is the status code of the HTTP response or 0 for the default
+	// status code.
+	code int
+
+	// marshal encodes the JSON bodies that augmenters embed fields into so
+	// that they follow the field naming of the out codec. Nil if the out
+	// codec doesn't encode JSON in which case nothing is embedded.
+	marshal func(interface{}) ([]byte, error)
+}
+
+// addHeader adds a header to the response.
+func (resp *response) addHeader(key, value string) {
+	if resp.header == nil {
+		resp.header = make(http.Header)
+	}
+	resp.header.Add(key, value)
+}
+
+// augmenter is implemented by types that wrap the body returned by a handler
+// in order to augment the HTTP response. The returned object replaces the
+// augmenter as the body of the response.
+type augmenter interface {
+	augment(resp *response) interface{}
+}
+
+// invoke calls the handler with the given HTTP request, path arguments and
+// body. The HTTP writer and request are only used to inject the special
+// arguments of the handler and can be nil. The returned body is serialized via
+// the out codec while the body is deserialized via the in codec. Both codecs
+// default to JSONCodec if nil.
+func (route *Route) invoke(
+	in, out Codec,
+	writer http.ResponseWriter, httpReq *http.Request,
+	args []string, body io.Reader) (resp response, restErr *Error) {
 	var err error
-	var in []reflect.Value
+	var values []reflect.Value
 
-	for i := 0; i < route.handlerType.NumIn(); i++ {
+	if in == nil {
+		in = JSONCodec
+	}
+	if out == nil {
+		out = JSONCodec
+	}
+
+	if codec, ok := out.(jsonCodec); ok {
+		resp.marshal = codec.Marshal
+	}
+
+	for i := 0; i < route.inSpecial; i++ {
+		switch route.handlerType.In(i) {
+
+		case requestType:
+			values = append(values, reflect.ValueOf(httpReq))
+
+		case writerType:
+			values = append(values, reflect.ValueOf(&writer).Elem())
+
+		case contextType:
+			ctx := context.Background()
+			if httpReq != nil {
+				ctx = httpReq.Context()
+			}
+			values = append(values, reflect.ValueOf(&ctx).Elem())
+		}
+	}
+
+	for i, j := route.inSpecial, 0; i < route.handlerType.NumIn(); i++ {
 		arg := reflect.New(route.handlerType.In(i))
 
-		if i < len(args) {
-			err = route.parseArg(args[i], arg.Elem())
+		if name, ok := route.CookieParams[i]; ok {
+			if httpReq != nil {
+				if cookie, cookieErr := httpReq.Cookie(name); cookieErr == nil {
+					err = route.parseArg(cookie.Value, arg.Elem())
+				}
+			}
+
+		} else if i == route.inStruct {
+			for k, field := range route.structFields {
+				if k < len(args) && err == nil {
+					err = route.parseArg(args[k], arg.Elem().Field(field))
+				}
+			}
+			j++
+
+		} else if j < route.inPath {
+			// Missing optional path arguments are left to their zero value.
+			if j < len(args) {
+				err = route.parseArg(args[j], arg.Elem())
+			}
+			j++
+
 		} else {
-			err = json.Unmarshal(body, arg.Interface())
+			err = unmarshalBody(in, body, arg.Interface())
 		}
 
 		if err != nil {
-			return nil, &Error{UnmarshalError, err}
+			return resp, &Error{UnmarshalError, err}
 		}
 
-		in = append(in, arg.Elem())
+		values = append(values, arg.Elem())
 	}
 
-	out := route.handler.Call(in)
+	results := route.handler.Call(values)
 
-	if route.outError >= 0 && !out[route.outError].IsNil() {
-		err := out[route.outError].Interface().(error)
-		return nil, &Error{HandlerError, err}
+	if route.outError >= 0 && !results[route.outError].IsNil() {
+		err := results[route.outError].Interface().(error)
+		return resp, &Error{HandlerError, err}
 	}
 
-	var ret []byte
+	if route.outStatus >= 0 {
+		resp.code = int(results[route.outStatus].Int())
+	}
+
+	if route.inWriter || route.outBody < 0 || route.isNil(results[route.outBody]) {
+		return
+	}
+
+	obj := results[route.outBody].Interface()
+	for aug, ok := obj.(augmenter); ok; aug, ok = obj.(augmenter) {
+		obj = aug.augment(&resp)
+	}
+
+	if obj == nil {
+		return
+	}
+
+	switch obj := obj.(type) {
+
+	case []byte:
+		resp.body, resp.contentType = obj, route.rawContentType()
 
-	if route.outBody >= 0 && !route.isNil(out[route.outBody]) {
-		if ret, err = json.Marshal(out[route.outBody].Interface()); err != nil {
-			return nil, &Error{MarshalError, err}
+	case io.Reader:
+		resp.reader, resp.contentType = obj, route.rawContentType()
+
+	case PreCompressed:
+		resp.body, resp.encoding = obj.Body, obj.Encoding
+		resp.contentType = "application/json"
+
+	case *PreCompressed:
+		resp.body, resp.encoding = obj.Body, obj.Encoding
+		resp.contentType = "application/json"
+
+	default:
+		if resp.body, err = out.Marshal(obj); err != nil {
+			return resp, &Error{MarshalError, err}
 		}
+		resp.contentType = out.ContentType()
 	}
 
-	return ret, nil
+	return
 }
 
 func (route *Route) HasBodyParam() bool {
@@ -259,6 +699,40 @@ func (route *Route) JsonSchema() string {
 	return ""
 }
 
+// ExampleRequest returns the JSON serialized example of the request body or an
+// empty string if there are no examples.
+func (route *Route) ExampleRequest() string {
+	return route.marshalExample(route.Example.Request)
+}
+
+// ExampleResponse returns the JSON serialized example of the response body or
+// an empty string if there are no examples.
+func (route *Route) ExampleResponse() string {
+	return route.marshalExample(route.Example.Response)
+}
+
+func (route *Route) marshalExample(obj interface{}) string {
+	if obj == nil {
+		return ""
+	}
+
+	encode := route.encode
+	if encode == nil {
+		encode = json.Marshal
+	}
+
+	js, err := encode(obj)
+	if err != nil {
+		return fmt.Sprintf("invalid example: %s", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := json.Indent(&buffer, js, "", "  "); err != nil {
+		return fmt.Sprintf("invalid example: %s", err)
+	}
+	return buffer.String()
+}
+
 // String returns a string represenation of the object suitable for debugging.
 func (route *Route) String() string {
 	return fmt.Sprintf("{ %s %s %s }", route.Method, route.Path, route.handlerType)
@@ -4,9 +4,15 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func printPath(path ...PathItem) string {
@@ -22,11 +28,11 @@ func printPath(path ...PathItem) string {
 }
 
 func f(name string) PathItem {
-	return PathItem{name, false}
+	return PathItem{Name: name}
 }
 
 func v(name string) PathItem {
-	return PathItem{name, true}
+	return PathItem{Name: name, IsArg: true}
 }
 
 func checkRoute(t *testing.T, handler interface{}, path string, exp ...PathItem) (route *Route) {
@@ -108,6 +114,25 @@ func TestRouteInit(t *testing.T) {
 	failRoute(t, func() (e0 error, e1 error) { return }, "")
 	failRoute(t, func() (i0 int, i1 int) { return }, "")
 	failRoute(t, func() (i0 int, i1 int, i2 int) { return }, "")
+	checkRoute(t, func() (t T, code int, err error) { return }, "")
+	failRoute(t, func() (o0 int, e0 error, i0 int) { return }, "")
+	failRoute(t, func() (o0 int, i0 int64, e0 error) { return }, "")
+	failRoute(t, func() (o0 int, i0 int, e0 error, e1 error) { return }, "")
+
+	failRoute(t, func() chan int { return nil }, "")
+	failRoute(t, func() (func(), error) { return nil, nil }, "")
+	failRoute(t, func() map[string][]complex128 { return nil }, "")
+	failRoute(t, func() *struct{ C chan int } { return nil }, "")
+
+	type recursive struct {
+		Next  *recursive
+		Items []recursive
+		c     chan int
+		D     chan int `json:"-"`
+	}
+	checkRoute(t, func() *recursive { return nil }, "")
+	checkRoute(t, func() interface{} { return nil }, "")
+	checkRoute(t, func() time.Time { return time.Time{} }, "")
 }
 
 func checkInvoke(t *testing.T, route *Route, exp string, body string, args ...PathItem) {
@@ -116,16 +141,16 @@ func checkInvoke(t *testing.T, route *Route, exp string, body string, args ...Pa
 		m = append(m, arg.Name)
 	}
 
-	ret, err := route.invoke(m, []byte(body))
+	ret, err := route.invoke(nil, nil, nil, nil, m, strings.NewReader(body))
 	if err != nil {
 		t.Errorf("FAIL%s: unexpected error '%s','%s' -> %s:%s",
 			route, body, printPath(args...), err.Type, err.Sub)
 		return
 	}
 
-	if string(ret) != exp {
+	if string(ret.body) != exp {
 		t.Errorf("FAIL%s: return mismatch '%s','%s' -> %s != %s",
-			route, body, printPath(args...), string(ret), exp)
+			route, body, printPath(args...), string(ret.body), exp)
 		return
 	}
 }
@@ -136,11 +161,11 @@ func failInvoke(t *testing.T, route *Route, exp ErrorType, body string, args ...
 		m = append(m, arg.Name)
 	}
 
-	ret, err := route.invoke(m, []byte(body))
+	ret, err := route.invoke(nil, nil, nil, nil, m, strings.NewReader(body))
 
 	if err == nil {
 		t.Errorf("FAIL%s: unexpected return '%s','%s' -> %s",
-			route, body, printPath(args...), string(ret))
+			route, body, printPath(args...), string(ret.body))
 		return
 	}
 
@@ -236,6 +261,82 @@ func TestRouteInvokeFloat(t *testing.T) {
 	failInvoke(t, rFloatArg, UnmarshalError, "", v("abc"))
 }
 
+func TestRouteInvokeSlice(t *testing.T) {
+	hStrs := func(s []string) int { return len(s) }
+
+	rStrs := checkRoute(t, hStrs, "strs/:arg", f("strs"), v("arg"))
+	checkInvoke(t, rStrs, "3", "", v("a,b,c"))
+	checkInvoke(t, rStrs, "1", "", v("a"))
+
+	hInts := func(i []int) (sum int) {
+		for _, x := range i {
+			sum += x
+		}
+		return
+	}
+
+	rInts := checkRoute(t, hInts, "ints/:arg", f("ints"), v("arg"))
+	checkInvoke(t, rInts, "123", "", v("100,20,3"))
+	checkInvoke(t, rInts, "0", "", v(""))
+	failInvoke(t, rInts, UnmarshalError, "", v("100,a,3"))
+	failInvoke(t, rInts, UnmarshalError, "", v("100,,3"))
+
+	hObjs := func(o []T) int { return len(o) }
+
+	rObjs := checkRoute(t, hObjs, "objs/:arg", f("objs"), v("arg"))
+	failInvoke(t, rObjs, UnmarshalError, "", v("a,b"))
+}
+
+func TestRouteInvokeMap(t *testing.T) {
+	hMap := func(m map[string]int) int { return m["a"] + m["b"] }
+
+	rMap := checkRoute(t, hMap, "map/:arg", f("map"), v("arg"))
+	checkInvoke(t, rMap, "3", "", v(`{"a":1,"b":2}`))
+	failInvoke(t, rMap, UnmarshalError, "", v(`{"a":1`))
+	failInvoke(t, rMap, UnmarshalError, "", v(`{"a":"b"}`))
+}
+
+type ID struct{ Prefix, Num string }
+
+func (id *ID) UnmarshalText(text []byte) error {
+	i := bytes.IndexByte(text, '-')
+	if i < 0 {
+		return fmt.Errorf("invalid id: %s", text)
+	}
+	id.Prefix, id.Num = string(text[:i]), string(text[i+1:])
+	return nil
+}
+
+func TestRouteInvokeTextUnmarshaler(t *testing.T) {
+	hTime := func(when time.Time) int { return when.Year() }
+
+	rTime := checkRoute(t, hTime, "time/:arg", f("time"), v("arg"))
+	checkInvoke(t, rTime, "2014", "", v("2014-03-04T05:06:07Z"))
+	failInvoke(t, rTime, UnmarshalError, "", v("yesterday"))
+
+	hID := func(id ID) string { return id.Num + id.Prefix }
+
+	rID := checkRoute(t, hID, "id/:arg", f("id"), v("arg"))
+	checkInvoke(t, rID, `"123abc"`, "", v("abc-123"))
+	failInvoke(t, rID, UnmarshalError, "", v("abc"))
+
+	hIDPtr := func(id *ID) string { return id.Prefix }
+
+	rIDPtr := checkRoute(t, hIDPtr, "idptr/:arg", f("idptr"), v("arg"))
+	checkInvoke(t, rIDPtr, `"abc"`, "", v("abc-123"))
+
+	hIP := func(ip net.IP) bool { return ip.IsLoopback() }
+
+	rIP := checkRoute(t, hIP, "ip/:arg", f("ip"), v("arg"))
+	checkInvoke(t, rIP, "true", "", v("127.0.0.1"))
+	failInvoke(t, rIP, UnmarshalError, "", v("127.0.0"))
+
+	hIDs := func(ids []ID) int { return len(ids) }
+
+	rIDs := checkRoute(t, hIDs, "ids/:arg", f("ids"), v("arg"))
+	checkInvoke(t, rIDs, "2", "", v("a-1,b-2"))
+}
+
 func TestRouteInvokeObj(t *testing.T) {
 	hObj := func(t T) T { return T{t.Value + 1} }
 
@@ -294,13 +395,17 @@ func TestRouteInvokeError(t *testing.T) {
 }
 
 func BenchRouteInvoke(b *testing.B, route *Route, args []string, body []byte) {
-	if _, err := route.invoke(args, body); err != nil {
+	BenchRouteInvokeCodec(b, nil, route, args, body)
+}
+
+func BenchRouteInvokeCodec(b *testing.B, codec Codec, route *Route, args []string, body []byte) {
+	if _, err := route.invoke(codec, nil, nil, nil, args, bytes.NewReader(body)); err != nil {
 		panic("failed bench")
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		route.invoke(args, body)
+		route.invoke(codec, nil, nil, nil, args, bytes.NewReader(body))
 	}
 }
 
@@ -366,3 +471,106 @@ func BenchmarkRouteInvokeAll(b *testing.B) {
 
 	BenchRouteInvoke(b, route, args, body)
 }
+
+func TestRouteInvokeRequest(t *testing.T) {
+	hReq := func(r *http.Request, a int) string { return fmt.Sprintf("%s:%d", r.Header.Get("X-Test"), a) }
+	rReq := checkRoute(t, hReq, "req/:a", f("req"), v("a"))
+
+	hCtx := func(ctx context.Context, r *http.Request, a int, b int) int { return a + b }
+	rCtx := checkRoute(t, hCtx, "ctx/:a", f("ctx"), v("a"))
+
+	hNil := func(r *http.Request) bool { return r == nil }
+	rNil := checkRoute(t, hNil, "nil", f("nil"))
+	checkInvoke(t, rNil, "true", "")
+
+	failRoute(t, hReq, "req/:a/:b")
+	failRoute(t, hCtx, "ctx/:a/:b/:c")
+
+	httpReq := httptest.NewRequest("GET", "/req/1", nil)
+	httpReq.Header.Set("X-Test", "blah")
+
+	if ret, err := rReq.invoke(nil, nil, nil, httpReq, []string{"1"}, nil); err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	} else if string(ret.body) != `"blah:1"` {
+		t.Errorf("FAIL: unexpected return: %s", ret.body)
+	}
+
+	if ret, err := rCtx.invoke(nil, nil, nil, httpReq, []string{"1"}, strings.NewReader("2")); err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	} else if string(ret.body) != "3" {
+		t.Errorf("FAIL: unexpected return: %s", ret.body)
+	}
+}
+
+// bufferedCodec hides the StreamDecoder implementation of the wrapped codec.
+type bufferedCodec struct{ Codec }
+
+func largeBody() []byte {
+	var items []string
+	for i := 0; i < 10000; i++ {
+		items = append(items, fmt.Sprintf(`{"key":"key-%d","val":"val-%d"}`, i, i))
+	}
+	return []byte("[" + strings.Join(items, ",") + "]")
+}
+
+func BenchmarkRouteInvokeLargeBodyStream(b *testing.B) {
+	body := largeBody()
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	BenchRouteInvoke(b, NewRoute("", "POST", func([]KV) {}), nil, body)
+}
+
+func BenchmarkRouteInvokeLargeBodyBuffered(b *testing.B) {
+	body := largeBody()
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	BenchRouteInvokeCodec(b, bufferedCodec{JSONCodec}, NewRoute("", "POST", func([]KV) {}), nil, body)
+}
+
+func TestRouteInvokePathStruct(t *testing.T) {
+	type params struct {
+		User string `rest:"user"`
+		ID   int    `rest:"id"`
+	}
+
+	route := NewRoute("/users/:user/posts/:id", "PUT", func(p params, kv KV) string {
+		return fmt.Sprintf("%s:%d:%s", p.User, p.ID, kv.Key)
+	})
+
+	ret, err := route.invoke(nil, nil, nil, nil, []string{"bob", "10"}, strings.NewReader(`{"key":"a"}`))
+	if err != nil {
+		t.Errorf("FAIL: unexpected error: %s", err)
+	} else if string(ret.body) != `"bob:10:a"` {
+		t.Errorf("FAIL: unexpected return: %s", ret.body)
+	}
+
+	if _, err := route.invoke(nil, nil, nil, nil, []string{"bob", "x"}, strings.NewReader(`{}`)); err == nil || err.Type != UnmarshalError {
+		t.Errorf("FAIL(invalid): expected UnmarshalError: %v", err)
+	}
+
+	type partial struct {
+		User string `rest:"user"`
+	}
+	failRoute(t, func(p partial) {}, "/users/:user/posts/:id")
+}
+
+func TestPathArgNames(t *testing.T) {
+	check := func(path string, exp ...string) {
+		names := NewPath(path).ArgNames()
+		if len(names) != len(exp) {
+			t.Errorf("FAIL(%s): unexpected names: %v != %v", path, names, exp)
+			return
+		}
+		for i := range exp {
+			if names[i] != exp[i] {
+				t.Errorf("FAIL(%s): unexpected names: %v != %v", path, names, exp)
+				return
+			}
+		}
+	}
+
+	check("/users/:id/posts/:postId", "id", "postId")
+	check("/files/:dir/:path...?", "dir", "path")
+	check("/a/b")
+	check("/")
+}
@@ -3,13 +3,90 @@
 package rest
 
 import (
-	"log"
+	"regexp"
+	"sort"
+	"strings"
 )
 
+// Router matches the method and path of requests against a set of routes. It's
+// the routing table of Mux and can be used on its own to build custom handlers
+// or to validate paths. Constant path items take precedence over arguments
+// which take precedence over catch-all arguments, unless a route has a higher
+// Priority. The zero value is an empty router ready to use.
+type Router struct {
+
+	// CaseInsensitive indicates that the constant items of the route paths
+	// are matched without regard to case. Must be set before any routes are
+	// added.
+	CaseInsensitive bool
+
+	root router
+}
+
+// Add initializes the given route and adds it to the router. Panics if a route
+// with the same method and path was already added.
+func (rt *Router) Add(route *Route) *Route {
+	rt.root.foldCase = rt.CaseInsensitive
+	return rt.root.Add(route)
+}
+
+// Match returns the route registered for the given method and path along with
+// the path arguments extracted from the path. Returns false if no routes
+// matched.
+func (rt *Router) Match(method, path string) (*Route, []string, bool) {
+	route, args := rt.root.Route(method, path)
+	if route == nil {
+		return nil, nil, false
+	}
+	return route, args, true
+}
+
+// Methods returns the sorted list of HTTP methods registered for the given
+// path.
+func (rt *Router) Methods(path string) []string {
+	return rt.root.Methods(path)
+}
+
+// Routes returns all the routes of the router sorted by path and method.
+func (rt *Router) Routes() Routes {
+	routes := rt.root.PrintRoutes(make(Routes, 0))
+	sort.Slice(routes, func(i, j int) bool {
+		if a, b := routes[i].Path.String(), routes[j].Path.String(); a != b {
+			return a < b
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
 type router struct {
 	routes   map[string]*Route
 	fixed    map[string]*router
 	variable *router
+	catchAll *router
+
+	// constrained holds the nodes of the arguments constrained by a pattern,
+	// in the order they were added, which are tried before variable.
+	constrained []*router
+
+	// pattern is the compiled pattern of the argument leading to this node.
+	pattern *regexp.Regexp
+
+	// priority is the highest priority of all the routes reachable from this
+	// node.
+	priority int
+
+	// foldCase indicates that constant path items are matched without regard
+	// to case. Inherited by the nodes created via add.
+	foldCase bool
+}
+
+// key returns the key of the given constant path item in the fixed map.
+func (rt *router) key(name string) string {
+	if rt.foldCase {
+		return strings.ToLower(name)
+	}
+	return name
 }
 
 func (rt *router) Add(route *Route) *Route {
@@ -19,25 +96,52 @@ func (rt *router) Add(route *Route) *Route {
 }
 
 func (rt *router) add(path Path, route *Route) {
-	if len(path) == 0 {
+	if route.Priority > rt.priority {
+		rt.priority = route.Priority
+	}
+
+	if len(path) == 0 || path[0].IsOptional {
 		if rt.routes == nil {
 			rt.routes = make(map[string]*Route)
 		}
 
 		if _, ok := rt.routes[route.Method]; ok {
-			log.Panicf("duplicate route: %s", route.Path)
+			route.panicf("duplicate route: %s", route.Path)
 		}
 
 		rt.routes[route.Method] = route
-		return
+		if len(path) == 0 {
+			return
+		}
 	}
 
 	var ok bool
 	var next *router
 
-	if path[0].IsArg {
+	if path[0].IsCatchAll {
+		if rt.catchAll == nil {
+			rt.catchAll = &router{priority: route.Priority, foldCase: rt.foldCase}
+		}
+		next = rt.catchAll
+
+	} else if path[0].IsArg && len(path[0].Pattern) > 0 {
+		// The pattern was validated when the route was initialized.
+		pattern, _ := compilePattern(path[0].Pattern)
+
+		for _, node := range rt.constrained {
+			if node.pattern.String() == pattern.String() {
+				next = node
+			}
+		}
+
+		if next == nil {
+			next = &router{priority: route.Priority, foldCase: rt.foldCase, pattern: pattern}
+			rt.constrained = append(rt.constrained, next)
+		}
+
+	} else if path[0].IsArg {
 		if rt.variable == nil {
-			rt.variable = new(router)
+			rt.variable = &router{priority: route.Priority, foldCase: rt.foldCase}
 		}
 		next = rt.variable
 
@@ -46,9 +150,10 @@ func (rt *router) add(path Path, route *Route) {
 			rt.fixed = make(map[string]*router)
 		}
 
-		if next, ok = rt.fixed[path[0].Name]; !ok {
-			next = new(router)
-			rt.fixed[path[0].Name] = next
+		key := rt.key(path[0].Name)
+		if next, ok = rt.fixed[key]; !ok {
+			next = &router{priority: route.Priority, foldCase: rt.foldCase}
+			rt.fixed[key] = next
 		}
 	}
 
@@ -70,33 +175,122 @@ func (rt *router) route(method string, path []string, args []string) (*Route, []
 		return nil, args
 	}
 
+	var route *Route
+	routeArgs := args
+
 	if rt.fixed != nil {
-		if next, ok := rt.fixed[path[0]]; ok {
-			return next.route(method, path[1:], args)
+		if next, ok := rt.fixed[rt.key(path[0])]; ok {
+			route, routeArgs = next.route(method, path[1:], args)
 		}
 	}
 
-	if rt.variable != nil {
-		args = append(args, path[0])
-		return rt.variable.route(method, path[1:], args)
+	// A constant match takes precedence over a variable match unless the
+	// variable match has a strictly higher priority. Constrained arguments
+	// are tried before unconstrained ones.
+	for _, next := range rt.args() {
+		if route != nil && route.Priority >= next.priority {
+			continue
+		}
+
+		if next.pattern != nil && !next.pattern.MatchString(path[0]) {
+			continue
+		}
+
+		varArgs := args
+		if route != nil {
+			// Prevents the append from overwriting the args of the constant match.
+			varArgs = args[:len(args):len(args)]
+		}
+
+		varRoute, varArgs := next.route(method, path[1:], append(varArgs, path[0]))
+		if varRoute != nil && (route == nil || varRoute.Priority > route.Priority) {
+			route, routeArgs = varRoute, varArgs
+		}
+	}
+
+	// A catch-all match has the lowest precedence and captures the rest of the
+	// path as a single argument.
+	if rt.catchAll != nil && (route == nil || route.Priority < rt.catchAll.priority) {
+		if catchRoute, ok := rt.catchAll.routes[method]; ok {
+			if route == nil || catchRoute.Priority > route.Priority {
+				catchArgs := append(args[:len(args):len(args)], strings.Join(path, "/"))
+				return catchRoute, catchArgs
+			}
+		}
 	}
 
-	return nil, args
+	return route, routeArgs
+}
+
+// args returns the nodes of the arguments in the order they're tried.
+func (rt *router) args() []*router {
+	if rt.variable == nil {
+		return rt.constrained
+	}
+	return append(rt.constrained[:len(rt.constrained):len(rt.constrained)], rt.variable)
+}
+
+// Methods returns the sorted list of HTTP methods registered for the given
+// path regardless of which route would be selected for each method.
+func (rt *router) Methods(path string) []string {
+	set := make(map[string]struct{})
+	rt.methods(SplitPath(path), set)
+
+	var methods []string
+	for method := range set {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (rt *router) methods(path []string, set map[string]struct{}) {
+	if len(path) == 0 {
+		for method := range rt.routes {
+			set[method] = struct{}{}
+		}
+		return
+	}
+
+	if next, ok := rt.fixed[rt.key(path[0])]; ok {
+		next.methods(path[1:], set)
+	}
+
+	for _, next := range rt.args() {
+		if next.pattern == nil || next.pattern.MatchString(path[0]) {
+			next.methods(path[1:], set)
+		}
+	}
+
+	if rt.catchAll != nil {
+		rt.catchAll.methods(nil, set)
+	}
 }
 
 func (rt *router) PrintRoutes(routes Routes) Routes {
+	return rt.printRoutes(0, routes)
+}
+
+func (rt *router) printRoutes(depth int, routes Routes) Routes {
 	if rt.routes != nil {
 		for _, route := range rt.routes {
-			routes = append(routes, route)
+			// Routes with optional arguments are also registered at the
+			// nodes of their prefixes but are only listed once.
+			if len(route.Path) == depth {
+				routes = append(routes, route)
+			}
 		}
 	}
 	if rt.fixed != nil {
 		for _, r := range rt.fixed {
-			routes = r.PrintRoutes(routes)
+			routes = r.printRoutes(depth+1, routes)
 		}
 	}
-	if rt.variable != nil {
-		routes = rt.variable.PrintRoutes(routes)
+	for _, next := range rt.args() {
+		routes = next.printRoutes(depth+1, routes)
+	}
+	if rt.catchAll != nil {
+		routes = rt.catchAll.printRoutes(depth+1, routes)
 	}
 	return routes
 }
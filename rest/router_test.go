@@ -3,6 +3,7 @@
 package rest
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -190,3 +191,195 @@ func BenchmarkRouterUnknownDeep(b *testing.B) {
 func BenchmarkRouterUnknownVariable(b *testing.B) {
 	BenchRouter(b, "/1/2/3/4")
 }
+
+func TestRouterPriority(t *testing.T) {
+	h0 := func() {}
+	h1 := func(a string) {}
+	h2 := func(a, b string) {}
+
+	newRoute := func(path string, handler interface{}, priority int) *Route {
+		route := &Route{Path: NewPath(path), Method: "GET", Handler: handler, Priority: priority}
+		route.Init()
+		return route
+	}
+
+	rt := &router{}
+
+	r0 := rt.Add(newRoute("/:a", h1, 0))
+	r1 := rt.Add(newRoute("/a", h0, 1))
+	rt.Add(newRoute("/users/me", h0, 0))
+	r3 := rt.Add(newRoute("/users/:id", h1, 1))
+	r4 := rt.Add(newRoute("/b/c", h0, 0))
+	r5 := rt.Add(newRoute("/:a/:b", h2, -1))
+	r6 := rt.Add(newRoute("/d/:b", h1, -1))
+
+	checkRouter(t, rt, "/a", "GET", r1)
+	checkRouter(t, rt, "/b", "GET", r0, v("b"))
+	checkRouter(t, rt, "/users/me", "GET", r3, v("me"))
+	checkRouter(t, rt, "/users/you", "GET", r3, v("you"))
+	checkRouter(t, rt, "/b/c", "GET", r4)
+	checkRouter(t, rt, "/b/d", "GET", r5, v("b"), v("d"))
+	checkRouter(t, rt, "/d/e", "GET", r6, v("e"))
+	checkRouter(t, rt, "/users/me/x", "GET", nil)
+}
+
+func checkMethods(t *testing.T, rt *router, path string, exp ...string) {
+	methods := rt.Methods(path)
+	if len(methods) != len(exp) {
+		t.Errorf("FAIL: methods mismatch for '%s' -> %v != %v", path, methods, exp)
+		return
+	}
+
+	for i := range exp {
+		if methods[i] != exp[i] {
+			t.Errorf("FAIL: methods mismatch for '%s' -> %v != %v", path, methods, exp)
+			return
+		}
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	h0 := func() {}
+	h1 := func(a int) {}
+
+	rt := &router{}
+	rt.Add(NewRoute("/a", "GET", h0))
+	rt.Add(NewRoute("/a", "PUT", h0))
+	rt.Add(NewRoute("/:a", "DELETE", h1))
+	rt.Add(NewRoute("/a/b", "POST", h0))
+
+	checkMethods(t, rt, "/a", "DELETE", "GET", "PUT")
+	checkMethods(t, rt, "/b", "DELETE")
+	checkMethods(t, rt, "/a/b", "POST")
+	checkMethods(t, rt, "/a/c")
+	checkMethods(t, rt, "/")
+}
+
+func TestRouterCatchAll(t *testing.T) {
+	h1 := func(a string) {}
+	h2 := func(a, b string) {}
+
+	rt := &router{}
+	r0 := rt.Add(NewRoute("/files/:path...", "GET", h1))
+	r1 := rt.Add(NewRoute("/files/a/b", "GET", func() {}))
+	r2 := rt.Add(NewRoute("/files/:dir/c", "GET", h1))
+	r3 := rt.Add(NewRoute("/:user/files/:path...", "GET", h2))
+
+	checkRouter(t, rt, "/files/a", "GET", r0, v("a"))
+	checkRouter(t, rt, "/files/a/b/c/", "GET", r0, v("a/b/c"))
+	checkRouter(t, rt, "/files/a/b", "GET", r1)
+	checkRouter(t, rt, "/files/b/c", "GET", r2, v("b"))
+	checkRouter(t, rt, "/files/b/c/d", "GET", r0, v("b/c/d"))
+	checkRouter(t, rt, "/bob/files/x/y", "GET", r3, v("bob"), v("x/y"))
+	checkRouter(t, rt, "/files", "GET", nil)
+	checkRouter(t, rt, "/files/a", "POST", nil)
+
+	checkMethods(t, rt, "/files/x/y", "GET")
+
+	if path := NewPath("/files/:path...").String(); path != "/files/:path.../" {
+		t.Errorf("FAIL: unexpected path string: %s", path)
+	}
+
+	failRoute(t, h1, "/x/:path.../y")
+}
+
+func TestRouterOptional(t *testing.T) {
+	h2 := func(a, b string) {}
+
+	rt := &router{}
+	r0 := rt.Add(NewRoute("/users/:id/:section?", "GET", h2))
+	r1 := rt.Add(NewRoute("/files/:dir/:path...?", "GET", h2))
+	r2 := rt.Add(NewRoute("/opt/:a?/:b?", "GET", h2))
+
+	checkRouter(t, rt, "/users/1/profile", "GET", r0, v("1"), v("profile"))
+	checkRouter(t, rt, "/users/1", "GET", r0, v("1"))
+	checkRouter(t, rt, "/users", "GET", nil)
+	checkRouter(t, rt, "/files/a/b/c", "GET", r1, v("a"), v("b/c"))
+	checkRouter(t, rt, "/files/a", "GET", r1, v("a"))
+	checkRouter(t, rt, "/opt/x/y", "GET", r2, v("x"), v("y"))
+	checkRouter(t, rt, "/opt/x", "GET", r2, v("x"))
+	checkRouter(t, rt, "/opt", "GET", r2)
+
+	if path := NewPath("/files/:dir/:path...?").String(); path != "/files/:dir/:path...?/" {
+		t.Errorf("FAIL: unexpected path string: %s", path)
+	}
+
+	failRoute(t, h2, "/x/:a?/:b")
+	failRoute(t, h2, "/x/:a/:b?/c")
+	failAdd(t, rt, NewRoute("/users/:id", "GET", func(id string) {}))
+
+	if routes := rt.PrintRoutes(nil); len(routes) != 3 {
+		t.Errorf("FAIL: unexpected routes: %v", routes)
+	}
+}
+
+func TestRouterConstraint(t *testing.T) {
+	h1 := func(a string) {}
+
+	rt := &router{}
+	r0 := rt.Add(NewRoute("/users/:id:[0-9]+", "GET", h1))
+	r1 := rt.Add(NewRoute("/users/:name:[a-z]+", "GET", h1))
+	r2 := rt.Add(NewRoute("/users/me", "GET", func() {}))
+	r3 := rt.Add(NewRoute("/items/:id:[0-9]+", "GET", h1))
+	r4 := rt.Add(NewRoute("/items/:id", "GET", h1))
+	r5 := rt.Add(NewRoute("/items/:id:[0-9]+", "DELETE", h1))
+
+	checkRouter(t, rt, "/users/42", "GET", r0, v("42"))
+	checkRouter(t, rt, "/users/abc", "GET", r1, v("abc"))
+	checkRouter(t, rt, "/users/me", "GET", r2)
+	checkRouter(t, rt, "/users/a1", "GET", nil)
+	checkRouter(t, rt, "/items/42", "GET", r3, v("42"))
+	checkRouter(t, rt, "/items/abc", "GET", r4, v("abc"))
+	checkRouter(t, rt, "/items/42", "DELETE", r5, v("42"))
+	checkRouter(t, rt, "/items/abc", "DELETE", nil)
+
+	checkMethods(t, rt, "/items/42", "DELETE", "GET")
+	checkMethods(t, rt, "/items/abc", "GET")
+
+	if path := NewPath("/users/:id?:[0-9]+").String(); path != "/users/:id?:[0-9]+/" {
+		t.Errorf("FAIL: unexpected path string: %s", path)
+	}
+
+	failRoute(t, h1, "/users/:id:[0-9")
+	failRoute(t, h1, "/files/:path...:.*")
+	failAdd(t, rt, &Route{Path: Path{{Name: "id", IsArg: true, Pattern: "("}}, Method: "GET", Handler: h1})
+}
+
+func TestRouterMatch(t *testing.T) {
+	rt := &Router{CaseInsensitive: true}
+
+	r0 := rt.Add(NewRoute("/users/:id", "GET", func(id int) {}))
+	r1 := rt.Add(NewRoute("/users/:id", "DELETE", func(id int) {}))
+	r2 := rt.Add(NewRoute("/files/:path...", "GET", func(path string) {}))
+
+	check := func(method, path string, expRoute *Route, expArgs ...string) {
+		route, args, ok := rt.Match(method, path)
+		if ok != (expRoute != nil) || route != expRoute {
+			t.Errorf("FAIL(%s %s): unexpected match: %s %v != %s", method, path, route, ok, expRoute)
+		} else if ok && !reflect.DeepEqual(args, expArgs) {
+			t.Errorf("FAIL(%s %s): unexpected args: %v != %v", method, path, args, expArgs)
+		}
+	}
+
+	check("GET", "/users/42", r0, "42")
+	check("DELETE", "/Users/42/", r1, "42")
+	check("GET", "/files/a/b.txt", r2, "a/b.txt")
+	check("PUT", "/users/42", nil)
+	check("GET", "/users", nil)
+	check("GET", "/unknown/42", nil)
+
+	if methods := rt.Methods("/users/42"); !reflect.DeepEqual(methods, []string{"DELETE", "GET"}) {
+		t.Errorf("FAIL: unexpected methods: %v", methods)
+	}
+
+	if routes := rt.Routes(); !reflect.DeepEqual(routes, Routes{r2, r1, r0}) {
+		t.Errorf("FAIL: unexpected routes: %v", routes)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("FAIL: duplicate route added")
+		}
+	}()
+	rt.Add(NewRoute("/users/:id", "GET", func(id int) {}))
+}
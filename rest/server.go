@@ -22,14 +22,21 @@ func AddService(routable Routable) {
 	DefaultMux.AddService(routable)
 }
 
+// Server returns a new http.Server which serves the mux on the given address.
+// Unlike Serve, ListenAndServe and ListenAndServeTLS, the caller keeps a handle
+// on the server and can therefore drain in-flight requests via its Shutdown
+// method.
+func (mux *Mux) Server(addr string) *http.Server {
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
 // Serve is a proxy for the http.Serve function but using the DefaultMux.
 func Serve(l net.Listener, mux *Mux) error {
 	if mux == nil {
 		mux = DefaultMux
 	}
 
-	srv := &http.Server{Handler: mux}
-	return srv.Serve(l)
+	return mux.Server("").Serve(l)
 }
 
 // ListenAndServe is a proxy for the http.ListenAndServe function but using the
@@ -39,8 +46,7 @@ func ListenAndServe(addr string, mux *Mux) error {
 		mux = DefaultMux
 	}
 
-	server := &http.Server{Addr: addr, Handler: mux}
-	return server.ListenAndServe()
+	return mux.Server(addr).ListenAndServe()
 }
 
 // ListenAndServeTLS is a proxy for the http.ListenAndServeTLS function but
@@ -50,6 +56,5 @@ func ListenAndServeTLS(addr string, certFile string, keyFile string, mux *Mux) e
 		mux = DefaultMux
 	}
 
-	server := &http.Server{Addr: addr, Handler: mux}
-	return server.ListenAndServeTLS(certFile, keyFile)
+	return mux.Server(addr).ListenAndServeTLS(certFile, keyFile)
 }
@@ -0,0 +1,49 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMuxServerShutdown(t *testing.T) {
+	started := make(chan struct{})
+
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/slow", "GET", func() string {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return "done"
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("FAIL: unable to listen: %s", err)
+	}
+
+	server := mux.Server("")
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	client := &Client{Host: "http://" + listener.Addr().String()}
+	done := make(chan *Response, 1)
+	go func() { done <- client.NewRequest("GET").SetPath("/slow").Send() }()
+
+	<-started
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("FAIL: unexpected shutdown error: %s", err)
+	}
+
+	var body string
+	if resp := <-done; resp.GetBody(&body) != nil || body != "done" {
+		t.Errorf("FAIL: in-flight request was not drained: %v '%s'", resp.Error, body)
+	}
+
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("FAIL: unexpected serve error: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+type staticRoute struct {
+	prefix  string
+	handler http.Handler
+}
+
+// AddStatic serves the files of the given directory for GET and HEAD requests
+// whose path starts with the given prefix, which is relative to the root of the
+// mux. Files are served via http.FileServer which handles range requests and
+// content types. Routes registered with the mux take precedence over static
+// files and the longest matching prefix wins.
+func (mux *Mux) AddStatic(prefix, dir string) {
+	mux.Init()
+
+	prefix = strings.TrimRight(JoinPath(mux.Root, prefix), "/")
+	route := staticRoute{
+		prefix:  prefix,
+		handler: http.StripPrefix(prefix, http.FileServer(http.Dir(dir))),
+	}
+
+	mux.statics = append(mux.statics, route)
+}
+
+// static returns the handler of the static route with the longest prefix
+// matching the given request or nil if none match.
+func (mux *Mux) static(httpReq *http.Request) http.Handler {
+	if httpReq.Method != "GET" && httpReq.Method != "HEAD" {
+		return nil
+	}
+
+	var best *staticRoute
+	path := httpReq.URL.Path
+
+	for i := range mux.statics {
+		route := &mux.statics[i]
+
+		if path != route.prefix && !strings.HasPrefix(path, route.prefix+"/") {
+			continue
+		}
+
+		if best == nil || len(route.prefix) > len(best.prefix) {
+			best = route
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	return best.handler
+}
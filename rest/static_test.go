@@ -0,0 +1,56 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMuxAddStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-static")
+	if err != nil {
+		t.Fatalf("FAIL: unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1);"), 0644); err != nil {
+		t.Fatalf("FAIL: unable to write file: %s", err)
+	}
+
+	mux := &Mux{Root: "/api", DefaultHandler: namedHandler("default")}
+	mux.AddRoute(NewRoute("/assets/version", "GET", func() string { return "v1" }))
+	mux.AddStatic("/assets", dir)
+
+	check := func(title, method, path string, code int, exp string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", title, recorder.Code, code)
+		}
+		if body := recorder.Body.String(); len(exp) > 0 && body != exp {
+			t.Errorf("FAIL(%s): unexpected body: '%s' != '%s'", title, body, exp)
+		}
+	}
+
+	check("file", "GET", "/api/assets/app.js", http.StatusOK, "console.log(1);")
+	check("missing", "GET", "/api/assets/missing.js", http.StatusNotFound, "")
+	check("route", "GET", "/api/assets/version", http.StatusOK, `"v1"`)
+	check("method", "POST", "/api/assets/app.js", http.StatusTeapot, "default\n")
+	check("prefix", "GET", "/api/assetsx/app.js", http.StatusTeapot, "default\n")
+
+	httpReq := httptest.NewRequest("GET", "/api/assets/app.js", nil)
+	httpReq.Header.Set("Range", "bytes=0-6")
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if recorder.Code != http.StatusPartialContent || recorder.Body.String() != "console" {
+		t.Errorf("FAIL(range): unexpected response: %d '%s'", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+// Status can be returned by a route handler to respond with a specific status
+// code instead of the default 200 or, for empty bodies, 204. Typically used to
+// return 201 Created or 202 Accepted.
+type Status struct {
+
+	// Code is the status code of the response.
+	Code int
+
+	// Body is the body of the response. Can be nil.
+	Body interface{}
+}
+
+// WithStatus wraps the body of a response with the given status code.
+func WithStatus(code int, body interface{}) *Status {
+	return &Status{Code: code, Body: body}
+}
+
+func (status Status) augment(resp *response) interface{} {
+	resp.code = status.Code
+	return status.Body
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/created", "POST", func(kv KV) (*Status, error) { return WithStatus(http.StatusCreated, &kv), nil }),
+		NewRoute("/accepted", "POST", func() Status { return Status{Code: http.StatusAccepted} }),
+		NewRoute("/linked", "GET", func() *Status {
+			return WithStatus(http.StatusCreated, WithLinks(&KV{"a", "1"}, Link{Rel: "self", Href: "/a"}))
+		}),
+		NewRoute("/fail", "POST", func() (*Status, error) { return nil, fmt.Errorf("fail") }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("POST").SetPath("/created").SetBody(&KV{"a", "1"}).Send()
+	checkRespBody(t, "created", r0, &KV{"a", "1"})
+	if r0.Code != http.StatusCreated {
+		t.Errorf("FAIL(created): unexpected status code: %d", r0.Code)
+	}
+
+	r1 := client.NewRequest("POST").SetPath("/accepted").Send()
+	checkResp(t, "accepted", r1)
+	if r1.Code != http.StatusAccepted || len(r1.Body) != 0 {
+		t.Errorf("FAIL(accepted): unexpected response: %d '%s'", r1.Code, r1.Body)
+	}
+
+	r2 := client.NewRequest("GET").SetPath("/linked").Send()
+	checkRespBody(t, "linked", r2, &KV{"a", "1"})
+	if r2.Code != http.StatusCreated || r2.Header.Get("Link") != `</a>; rel="self"` {
+		t.Errorf("FAIL(linked): unexpected response: %d %v", r2.Code, r2.Header)
+	}
+
+	failResp(t, "fail", client.NewRequest("POST").SetPath("/fail").Send(), EndpointError, http.StatusBadRequest)
+}
+
+func TestStatusReturn(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(
+		NewRoute("/created", "POST", func(kv KV) (*KV, int, error) { return &kv, http.StatusCreated, nil }),
+		NewRoute("/default", "GET", func() (*KV, int, error) { return &KV{"a", "1"}, 0, nil }),
+		NewRoute("/accepted", "POST", func() (*KV, int, error) { return nil, http.StatusAccepted, nil }),
+		NewRoute("/fail", "POST", func() (*KV, int, error) { return nil, 0, fmt.Errorf("fail") }))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Host: server.URL}
+
+	r0 := client.NewRequest("POST").SetPath("/created").SetBody(&KV{"a", "1"}).Send()
+	checkRespBody(t, "created", r0, &KV{"a", "1"})
+	if r0.Code != http.StatusCreated {
+		t.Errorf("FAIL(created): unexpected status code: %d", r0.Code)
+	}
+
+	r1 := client.NewRequest("GET").SetPath("/default").Send()
+	checkRespBody(t, "default", r1, &KV{"a", "1"})
+	if r1.Code != http.StatusOK {
+		t.Errorf("FAIL(default): unexpected status code: %d", r1.Code)
+	}
+
+	r2 := client.NewRequest("POST").SetPath("/accepted").Send()
+	checkResp(t, "accepted", r2)
+	if r2.Code != http.StatusAccepted || len(r2.Body) != 0 {
+		t.Errorf("FAIL(accepted): unexpected response: %d '%s'", r2.Code, r2.Body)
+	}
+
+	failResp(t, "fail", client.NewRequest("POST").SetPath("/fail").Send(), EndpointError, http.StatusBadRequest)
+}
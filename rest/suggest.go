@@ -0,0 +1,64 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"strings"
+)
+
+// suggestRoute returns the templated path of the registered route closest to
+// the given path or an empty string if no routes are close enough. Argument
+// items of a route are matched against the corresponding items of the path
+// so that they don't count towards the distance.
+func (mux *Mux) suggestRoute(path string) string {
+	items := SplitPath(strings.TrimPrefix(path, mux.Root))
+	target := strings.Join(items, "/")
+
+	best, bestDist := "", len(target)/3+1
+
+	for _, route := range mux.router.Routes() {
+		filled := make([]string, len(route.Path))
+		for i, item := range route.Path {
+			if item.IsCatchAll && i < len(items) {
+				filled[i] = strings.Join(items[i:], "/")
+			} else if item.IsArg && i < len(items) {
+				filled[i] = items[i]
+			} else {
+				filled[i] = item.String()
+			}
+		}
+
+		if dist := levenshtein(target, strings.Join(filled, "/")); dist < bestDist {
+			best, bestDist = JoinPath(mux.Root, route.Path.String()), dist
+		}
+	}
+
+	return best
+}
+
+// levenshtein returns the edit distance between the two given strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
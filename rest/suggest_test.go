@@ -0,0 +1,50 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	check := func(a, b string, exp int) {
+		if dist := levenshtein(a, b); dist != exp {
+			t.Errorf("FAIL(%s, %s): distance mismatch %d != %d", a, b, dist, exp)
+		}
+	}
+
+	check("", "", 0)
+	check("abc", "", 3)
+	check("", "abc", 3)
+	check("kitten", "sitting", 3)
+	check("users", "user", 1)
+}
+
+func TestMuxSuggestRoutes(t *testing.T) {
+	mux := &Mux{Root: "/api", SuggestRoutes: true, DefaultHandler: namedHandler("default")}
+	mux.AddRoute(
+		NewRoute("/users/:id", "GET", func(id int) {}),
+		NewRoute("/orders", "GET", func() {}))
+
+	check := func(path string, code int, exp string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+		if recorder.Code != code {
+			t.Errorf("FAIL(%s): unexpected status code: %d != %d", path, recorder.Code, code)
+		}
+		if body := recorder.Body.String(); !strings.Contains(body, exp) {
+			t.Errorf("FAIL(%s): unexpected body: %s", path, body)
+		}
+	}
+
+	check("/api/user/10", http.StatusNotFound, "did you mean '/api/users/:id/'?")
+	check("/api/order", http.StatusNotFound, "did you mean '/api/orders/'?")
+	check("/completely/unrelated", http.StatusTeapot, "default")
+
+	mux.SuggestRoutes = false
+	check("/api/user/10", http.StatusTeapot, "default")
+}
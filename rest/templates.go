@@ -25,7 +25,7 @@ documentation = `
         <div class="col-xs-6">
             <div class="form-group">
                 <label for="body">Body</label>
-                <textarea id="body" class="form-control" rows="10">{{ .JsonSchema }}
+                <textarea id="body" class="form-control" rows="10">{{ if .ExampleRequest }}{{ .ExampleRequest }}{{ else }}{{ .JsonSchema }}{{ end }}
                 </textarea>
             </div>
         </div>
@@ -33,6 +33,17 @@ documentation = `
     {{ end }}
 {{ end }}
 
+{{ define "example-response" }}
+    {{ if .ExampleResponse }}
+    <div class="row">
+        <div class="col-xs-6">
+            <label>Example Response</label>
+            <pre class="example-response">{{ .ExampleResponse }}</pre>
+        </div>
+    </div>
+    {{ end }}
+{{ end }}
+
 {{$page := .}}
 
 <div class="text-center">
@@ -55,6 +66,7 @@ documentation = `
                     {{ template "path-param" $route.Path }}
                     <br>
                     {{ template "body-param" $route }}
+                    {{ template "example-response" $route }}
                 </form>
             </div>
             <div id="{{$route.Method}}-{{$route.Path}}"></div>
@@ -73,6 +85,7 @@ documentation = `
                     {{ template "path-param" $route.Path }}
                     <br>
                     {{ template "body-param" $route }}
+                    {{ template "example-response" $route }}
                 </form>
             </div>
             <div id="{{$route.Method}}-{{$route.Path}}"></div>
@@ -91,6 +104,7 @@ documentation = `
                     {{ template "path-param" $route.Path }}
                     <br>
                     {{ template "body-param" $route }}
+                    {{ template "example-response" $route }}
                 </form>
             </div>
             <div id="{{$route.Method}}-{{$route.Path}}"></div>
@@ -109,6 +123,7 @@ documentation = `
                     {{ template "path-param" $route.Path }}
                     <br>
                     {{ template "body-param" $route }}
+                    {{ template "example-response" $route }}
                 </form>
             </div>
             <div id="{{ printf "%s-%s" $route.Method $route.Path}}"></div>
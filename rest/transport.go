@@ -0,0 +1,93 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig holds the settings of the transport created by
+// NewTunedClient. Zero values keep the settings of http.DefaultTransport.
+type TransportConfig struct {
+
+	// MaxIdleConns is the maximum number of idle connections across all
+	// hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept for
+	// each host. The standard library defaults to 2 which is usually too low
+	// for services talking to a handful of hosts.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost bounds the total number of connections to each host,
+	// including the ones in use.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout is the maximum amount of time allowed to establish a
+	// connection.
+	DialTimeout time.Duration
+
+	// KeepAlive is the interval between the keep-alive probes of the open
+	// connections. A negative value disables the probes.
+	KeepAlive time.Duration
+
+	// TLSHandshakeTimeout is the maximum amount of time allowed for the TLS
+	// handshake.
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout is the maximum amount of time allowed to receive
+	// the headers of a response once the request was written.
+	ResponseHeaderTimeout time.Duration
+
+	// DisableKeepAlives closes the connections after each request.
+	DisableKeepAlives bool
+}
+
+// NewTunedClient creates a Client for the given host whose http.Client uses a
+// dedicated transport configured with the given settings.
+func NewTunedClient(host string, config TransportConfig) *Client {
+	return &Client{
+		Client: &http.Client{Transport: config.transport()},
+		Host:   host,
+	}
+}
+
+func (config TransportConfig) transport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if config.DialTimeout > 0 {
+		dialer.Timeout = config.DialTimeout
+	}
+	if config.KeepAlive != 0 {
+		dialer.KeepAlive = config.KeepAlive
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.DisableKeepAlives = config.DisableKeepAlives
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	if config.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+	if config.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+
+	return transport
+}
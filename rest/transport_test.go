@@ -0,0 +1,44 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTunedClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewTunedClient(server.URL, TransportConfig{
+		MaxIdleConnsPerHost:   64,
+		ResponseHeaderTimeout: 5 * time.Second,
+	})
+
+	transport, ok := client.Client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("FAIL: unexpected transport: %T", client.Client.Transport)
+	}
+
+	if transport.MaxIdleConnsPerHost != 64 {
+		t.Errorf("FAIL: unexpected MaxIdleConnsPerHost: %d", transport.MaxIdleConnsPerHost)
+	}
+	if transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("FAIL: unexpected ResponseHeaderTimeout: %s", transport.ResponseHeaderTimeout)
+	}
+
+	defaults := http.DefaultTransport.(*http.Transport)
+	if transport.IdleConnTimeout != defaults.IdleConnTimeout || transport.MaxIdleConns != defaults.MaxIdleConns {
+		t.Errorf("FAIL: defaults not preserved: %s %d", transport.IdleConnTimeout, transport.MaxIdleConns)
+	}
+	if transport == defaults {
+		t.Errorf("FAIL: default transport modified")
+	}
+
+	checkResp(t, "send", client.NewRequest("GET").Send())
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"strings"
+)
+
+// Warnings can be returned by a route handler to attach non-fatal warnings to
+// a successful response, such as deprecated parameter notices or partial
+// results. Each warning is rendered as an RFC 7234 Warning header with the 199
+// (miscellaneous) code and, if Embed is set, also embedded in a _warnings field
+// of the JSON body which must then be an object.
+type Warnings struct {
+
+	// Body is the body of the response.
+	Body interface{}
+
+	// Warnings is the list of warning messages to attach to the response.
+	Warnings []string
+
+	// Embed indicates that the warnings should also be embedded in the JSON
+	// body under the _warnings field. Ignored if the response is encoded by
+	// a codec other than JSON.
+	Embed bool
+}
+
+// WithWarnings wraps the body of a response with the given warnings.
+func WithWarnings(body interface{}, warnings ...string) Warnings {
+	return Warnings{Body: body, Warnings: warnings}
+}
+
+var warningEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (warnings Warnings) augment(resp *response) interface{} {
+	for _, warning := range warnings.Warnings {
+		resp.addHeader("Warning", `199 - "`+warningEscaper.Replace(warning)+`"`)
+	}
+
+	if !warnings.Embed || warnings.Body == nil || resp.marshal == nil {
+		return warnings.Body
+	}
+	return &warnedBody{warnings.Body, warnings.Warnings, resp.marshal}
+}
+
+type warnedBody struct {
+	body     interface{}
+	warnings []string
+	marshal  func(interface{}) ([]byte, error)
+}
+
+// MarshalJSON splices the _warnings field at the start of the marshalled body.
+func (warned *warnedBody) MarshalJSON() ([]byte, error) {
+	return embedField(warned.marshal, warned.body, "_warnings", warned.warnings)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	mux := new(Mux)
+	mux.AddRoute(NewRoute("/items", "GET", func() Warnings {
+		return WithWarnings(&KV{"a", "1"}, "param 'q' is deprecated", `partial "results"`)
+	}))
+	mux.AddRoute(NewRoute("/embed", "GET", func() Warnings {
+		return Warnings{Body: &KV{"a", "1"}, Warnings: []string{"partial results"}, Embed: true}
+	}))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/items", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("FAIL: unexpected status code: %d", recorder.Code)
+	}
+
+	exp := []string{
+		`199 - "param 'q' is deprecated"`,
+		`199 - "partial \"results\""`,
+	}
+
+	values := recorder.Header().Values("Warning")
+	if len(values) != len(exp) {
+		t.Errorf("FAIL: unexpected Warning headers: %v", values)
+	}
+	for i := 0; i < len(exp) && i < len(values); i++ {
+		if values[i] != exp[i] {
+			t.Errorf("FAIL: Warning header mismatch: %s != %s", values[i], exp[i])
+		}
+	}
+
+	if body := recorder.Body.String(); body != `{"key":"a","val":"1"}` {
+		t.Errorf("FAIL: unexpected body: %s", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/embed", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("FAIL(embed): unexpected status code: %d", recorder.Code)
+	}
+
+	expBody := `{"_warnings":["partial results"],"key":"a","val":"1"}`
+	if body := recorder.Body.String(); body != expBody {
+		t.Errorf("FAIL(embed): unexpected body: %s != %s", body, expBody)
+	}
+}
+
+func TestWarningsCodec(t *testing.T) {
+	mux := &Mux{Codecs: map[string]Codec{"application/xml": xmlCodec{}}}
+	mux.AddRoute(NewRoute("/embed", "GET", func() Warnings {
+		return Warnings{Body: &KV{"a", "1"}, Warnings: []string{"w"}, Embed: true}
+	}))
+
+	httpReq := httptest.NewRequest("GET", "/embed", nil)
+	httpReq.Header.Set("Accept", "application/xml")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httpReq)
+
+	if body := recorder.Body.String(); body != "<KV><Key>a</Key><Val>1</Val></KV>" {
+		t.Errorf("FAIL: unexpected body: %s", body)
+	}
+	if warning := recorder.Header().Get("Warning"); warning != `199 - "w"` {
+		t.Errorf("FAIL: unexpected Warning header: %s", warning)
+	}
+}